@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// the book fields a client can ask for with ?fields=
+var bookExportFields = []string{"id", "title", "authors", "isbn", "publication_date", "genre", "description", "average_rating", "language", "work_id", "version"}
+
+// how many records we write before flushing them to the client
+const exportFlushEvery = 100
+
+func (a *applicationDependencies) exportBooksHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParameterData struct {
+		Criteria data.BookSearchCriteria
+		Format   string
+		Fields   []string
+		data.Filters
+	}
+
+	queryParameter := r.URL.Query()
+
+	queryParameterData.Format = a.getSingleQueryParameter(queryParameter, "format", "csv")
+	queryParameterData.Fields = a.getMultipleQueryParameters(queryParameter, "fields", bookExportFields)
+
+	v := validator.New()
+
+	queryParameterData.Criteria = a.readBookSearchCriteria(r, queryParameter, v)
+
+	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "id")
+	queryParameterData.Filters.SortSafeList = []string{"relevance", "id", "title", "authors", "genre", "-id", "-title", "-authors", "-genre"}
+
+	data.ValidateBookSearchCriteria(v, queryParameterData.Criteria)
+	v.Check(validator.PermittedValue(queryParameterData.Format, "csv", "jsonl", "marc"), "format", "must be csv, jsonl or marc")
+	for _, field := range queryParameterData.Fields {
+		v.Check(validator.PermittedValue(field, bookExportFields...), "fields", "contains an unknown field "+strconv.Quote(field))
+	}
+	v.Check(validator.PermittedValue(queryParameterData.Filters.Sort, queryParameterData.Filters.SortSafeList...), "sort", "invalid sort value")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var contentType, extension string
+	switch queryParameterData.Format {
+	case "csv":
+		contentType, extension = "text/csv; charset=utf-8", "csv"
+	case "jsonl":
+		contentType, extension = "application/x-ndjson", "jsonl"
+	case "marc":
+		contentType, extension = "text/plain; charset=utf-8", "mrk"
+	}
+
+	// An export can take much longer than the server's write timeout,
+	// so we push the deadline forward every time we flush
+	rc := http.NewResponseController(w)
+	extendDeadline := func() {
+		rc.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	}
+	extendDeadline()
+
+	out := bufio.NewWriter(w)
+	written := 0
+	var csvWriter *csv.Writer
+	if queryParameterData.Format == "csv" {
+		csvWriter = csv.NewWriter(out)
+	}
+
+	// nothing is sent until the first book arrives so a failing
+	// query can still be reported as a normal JSON error
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="books.%s"`, extension))
+		w.WriteHeader(http.StatusOK)
+		if csvWriter != nil {
+			return csvWriter.Write(queryParameterData.Fields)
+		}
+		return nil
+	}
+
+	err := a.bookModel.Export(r.Context(), queryParameterData.Criteria,
+		queryParameterData.Filters, func(book *data.Book) error {
+			if !started {
+				err := start()
+				if err != nil {
+					return err
+				}
+			}
+
+			var err error
+			switch queryParameterData.Format {
+			case "csv":
+				record := make([]string, len(queryParameterData.Fields))
+				for i, field := range queryParameterData.Fields {
+					record[i] = fmt.Sprint(bookExportValue(book, field))
+				}
+				err = csvWriter.Write(record)
+			case "jsonl":
+				err = writeBookJSONLine(out, book, queryParameterData.Fields)
+			case "marc":
+				err = writeBookMARC(out, book)
+			}
+			if err != nil {
+				return err
+			}
+
+			written++
+			if written%exportFlushEvery == 0 {
+				if csvWriter != nil {
+					csvWriter.Flush()
+				}
+				err = out.Flush()
+				if err != nil {
+					return err
+				}
+				rc.Flush()
+				extendDeadline()
+			}
+			return nil
+		})
+	if err != nil {
+		if !started {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		// the status line has gone out already, all we can do is log
+		// the problem and cut the response short
+		a.logError(r, err)
+		return
+	}
+
+	if !started {
+		err = start()
+		if err != nil {
+			a.logError(r, err)
+			return
+		}
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+	}
+	err = out.Flush()
+	if err != nil {
+		a.logError(r, err)
+	}
+}
+
+// bookExportValue returns the value of one of the bookExportFields
+func bookExportValue(book *data.Book, field string) any {
+	switch field {
+	case "id":
+		return book.ID
+	case "title":
+		return book.Title
+	case "authors":
+		return book.Authors
+	case "isbn":
+		return book.ISBN
+	case "publication_date":
+		return book.PublicationDate
+	case "genre":
+		return book.Genre
+	case "description":
+		return book.Description
+	case "average_rating":
+		return book.AverageRating
+	case "language":
+		return book.Language
+	case "work_id":
+		return book.WorkID
+	case "version":
+		return book.Version
+	}
+	return nil
+}
+
+// writeBookJSONLine writes the selected fields of a book as one JSON
+// object followed by a newline, keeping the order the client asked for
+func writeBookJSONLine(out io.Writer, book *data.Book, fields []string) error {
+	var line strings.Builder
+	line.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		value, err := json.Marshal(bookExportValue(book, field))
+		if err != nil {
+			return err
+		}
+		line.WriteString(strconv.Quote(field))
+		line.WriteByte(':')
+		line.Write(value)
+	}
+	line.WriteString("}\n")
+
+	_, err := io.WriteString(out, line.String())
+	return err
+}
+
+// writeBookMARC writes a book as a MARC mnemonic (.mrk) style record.
+// It is not a full MARC 21 record but it maps our fields onto the tags
+// library tools expect: 020 ISBN, 100 author, 245 title, 264 publication
+// date, 520 summary and 655 genre
+func writeBookMARC(out io.Writer, book *data.Book) error {
+	escape := func(s string) string {
+		s = strings.ReplaceAll(s, "$", "{dollar}")
+		return strings.Join(strings.Fields(s), " ")
+	}
+
+	var record strings.Builder
+	fmt.Fprintf(&record, "=LDR  00000nam  2200000 a 4500\n")
+	fmt.Fprintf(&record, "=001  %d\n", book.ID)
+	fmt.Fprintf(&record, "=020  \\\\$a%s\n", escape(book.ISBN))
+	authors := strings.Split(book.Authors, ",")
+	for i, author := range authors {
+		tag := "700"
+		if i == 0 {
+			tag = "100"
+		}
+		fmt.Fprintf(&record, "=%s  1\\$a%s\n", tag, escape(author))
+	}
+	fmt.Fprintf(&record, "=245  10$a%s\n", escape(book.Title))
+	if book.PublicationDate != "" {
+		fmt.Fprintf(&record, "=264  \\1$c%s\n", escape(book.PublicationDate))
+	}
+	if book.Description != "" {
+		fmt.Fprintf(&record, "=520  \\\\$a%s\n", escape(book.Description))
+	}
+	if book.Genre != "" {
+		fmt.Fprintf(&record, "=655  \\7$a%s\n", escape(book.Genre))
+	}
+	record.WriteByte('\n')
+
+	_, err := io.WriteString(out, record.String())
+	return err
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// the largest import file we are willing to read (10MB)
+const maxImportBytes = 10_000_000
+
+// the columns a CSV import file may contain. The header row decides
+// the order so clients do not have to follow ours
+var bookImportColumns = []string{"title", "authors", "isbn", "publication_date", "genre", "description"}
+
+// the fields of one line of a JSON Lines import file
+type bookImportRecord struct {
+	Title           string `json:"title"`
+	Authors         string `json:"authors"`
+	ISBN            string `json:"isbn"`
+	PublicationDate string `json:"publication_date"`
+	Genre           string `json:"genre"`
+	Description     string `json:"description"`
+}
+
+func (a *applicationDependencies) importBooksHandler(w http.ResponseWriter, r *http.Request) {
+	queryParameters := r.URL.Query()
+	v := validator.New()
+
+	dryRun := false
+	if value := queryParameters.Get("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			v.AddError("dry_run", "must be true or false")
+		}
+		dryRun = parsed
+	}
+
+	format := a.importFormat(r)
+	v.Check(validator.PermittedValue(format, "csv", "jsonl"), "format", "must be csv or jsonl")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var records []bookImportRecord
+	var parseFailures []data.BookImportResult
+	var err error
+	switch format {
+	case "csv":
+		records, parseFailures, err = readBookImportCSV(body)
+	case "jsonl":
+		records, parseFailures, err = readBookImportJSONL(body)
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("the body must not be larger that %d bytes", maxBytesError.Limit)
+		}
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	report := data.NewBookImportReport(dryRun)
+	report.Failed = append(report.Failed, parseFailures...)
+
+	// validate every row on its own so a bad row does not hide
+	// problems further down the file
+	rows := []data.BookImportRow{}
+	for i, record := range records {
+		if record.Title == "" && record.ISBN == "" && record.Authors == "" {
+			// blank line, nothing to report
+			continue
+		}
+		book := &data.Book{
+			Title:           strings.TrimSpace(record.Title),
+			Authors:         strings.TrimSpace(record.Authors),
+			ISBN:            data.NormalizeISBN(record.ISBN),
+			PublicationDate: strings.TrimSpace(record.PublicationDate),
+			Genre:           strings.TrimSpace(record.Genre),
+			Description:     strings.TrimSpace(record.Description),
+		}
+
+		rowValidator := validator.New()
+		data.ValidateBook(rowValidator, book, a.contentPolicy.Load())
+		if !rowValidator.IsEmpty() {
+			report.Failed = append(report.Failed, data.BookImportResult{
+				Row: i + 1, ISBN: book.ISBN, Errors: rowValidator.Errors,
+			})
+			continue
+		}
+		rows = append(rows, data.BookImportRow{Row: i + 1, Book: book})
+	}
+
+	err = a.bookModel.Import(rows, report, a.contextGetUser(r).ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !dryRun && len(report.Created) > 0 {
+		status = http.StatusCreated
+	}
+
+	data := envelope{
+		"report": report,
+	}
+	err = a.writeJSON(w, status, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// importFormat works out the format of the uploaded file. An explicit
+// ?format= wins, otherwise we go by the Content-Type header
+func (a *applicationDependencies) importFormat(r *http.Request) string {
+	format := a.getSingleQueryParameter(r.URL.Query(), "format", "")
+	if format != "" {
+		return format
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return "csv"
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return "jsonl"
+	}
+	return ""
+}
+
+func readBookImportCSV(body io.Reader) ([]bookImportRecord, []data.BookImportResult, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	// rows are allowed to have a different number of fields, we
+	// report short rows through validation instead
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, errors.New("the body must not be empty")
+		}
+		return nil, nil, fmt.Errorf("unable to read the CSV header: %w", err)
+	}
+
+	positions := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.PermittedValue(name, bookImportColumns...) {
+			return nil, nil, fmt.Errorf("the CSV header contains unknown column %q", name)
+		}
+		positions[name] = i
+	}
+	for _, name := range []string{"title", "authors", "isbn"} {
+		if _, found := positions[name]; !found {
+			return nil, nil, fmt.Errorf("the CSV header must contain a %q column", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, found := positions[name]
+		if !found || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	var records []bookImportRecord
+	var failures []data.BookImportResult
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseError *csv.ParseError
+			if errors.As(err, &parseError) {
+				failures = append(failures, data.BookImportResult{
+					Row: row, Errors: map[string]string{"row": parseError.Err.Error()},
+				})
+				// keep the row numbering aligned with the file
+				records = append(records, bookImportRecord{})
+				continue
+			}
+			return nil, nil, err
+		}
+
+		records = append(records, bookImportRecord{
+			Title:           field(record, "title"),
+			Authors:         field(record, "authors"),
+			ISBN:            field(record, "isbn"),
+			PublicationDate: field(record, "publication_date"),
+			Genre:           field(record, "genre"),
+			Description:     field(record, "description"),
+		})
+	}
+
+	return records, failures, nil
+}
+
+func readBookImportJSONL(body io.Reader) ([]bookImportRecord, []data.BookImportResult, error) {
+	scanner := bufio.NewScanner(body)
+	// a single line holds a whole book, descriptions included
+	scanner.Buffer(make([]byte, 0, 64*1024), 1_000_000)
+
+	var records []bookImportRecord
+	var failures []data.BookImportResult
+	for row := 1; scanner.Scan(); row++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			records = append(records, bookImportRecord{})
+			continue
+		}
+
+		var record bookImportRecord
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&record)
+		if err != nil {
+			failures = append(failures, data.BookImportResult{
+				Row: row, Errors: map[string]string{"row": "contains badly-formed JSON: " + err.Error()},
+			})
+			records = append(records, bookImportRecord{})
+			continue
+		}
+		records = append(records, record)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("the body must not be empty")
+	}
+
+	return records, failures, nil
+}
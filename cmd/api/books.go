@@ -4,21 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 
 	// import the data package which contains the definition for Comment
 	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/metadata"
 	"github.com/mtechguy/test3/internal/validator"
 )
 
-var incomingData struct {
-	Title           *string `json:"title"`
-	Authors         *string `json:"authors"`
-	ISBN            *string `json:"isbn"`
-	PublicationDate *string `json:"publication_date"` // Use string to parse and validate date later
-	Genre           *string `json:"genre"`
-	Description     *string `json:"description"`
-}
-
 func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *http.Request) {
 	// create a struct to hold a comment
 	// we use struct tags to make the names display in lowercase
@@ -29,6 +24,7 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 		PublicationDate string `json:"publication_date"` // Use string to parse and validate date later
 		Genre           string `json:"genre"`
 		Description     string `json:"description"`
+		Language        string `json:"language"`
 	}
 	// perform the decoding
 	err := a.readJSON(w, r, &incomingData)
@@ -44,16 +40,30 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 		PublicationDate: incomingData.PublicationDate,
 		Genre:           incomingData.Genre,
 		Description:     incomingData.Description,
+		Language:        incomingData.Language,
 	}
 	// Initialize a Validator instance
 	v := validator.New()
 
-	data.ValidateBook(v, book)
+	// With ?enrich=true any field the client left out is filled in
+	// from the metadata provider before we validate
+	enrich := a.getSingleQueryParameter(r.URL.Query(), "enrich", "false")
+	v.Check(validator.PermittedValue(enrich, "true", "false"), "enrich", "must be true or false")
+	if enrich == "true" && data.ISBN13(book.ISBN) != "" {
+		book.ISBN = data.ISBN13(book.ISBN)
+		err = a.enrichBook(r.Context(), book)
+		if err != nil && !errors.Is(err, metadata.ErrNotFound) {
+			// the book can still be created with what the client sent
+			a.logError(r, err)
+		}
+	}
+
+	data.ValidateBook(v, book, a.contentPolicy.Load())
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors) // implemented later
 		return
 	}
-	err = a.bookModel.Insert(book)
+	err = a.bookModel.Insert(book, a.contextGetUser(r).ID)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -96,7 +106,7 @@ func (a *applicationDependencies) displayBookHandler(w http.ResponseWriter, r *h
 	data := envelope{
 		"Book": book,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSONWithETag(w, r, data, bookETag(book))
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -122,6 +132,21 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 		}
 		return
 	}
+	if !a.checkExpectedVersion(w, r, int64(book.Version)) {
+		return
+	}
+	before := *book
+
+	// the fields left out of the body are left as they are
+	var incomingData struct {
+		Title           *string `json:"title"`
+		Authors         *string `json:"authors"`
+		ISBN            *string `json:"isbn"`
+		PublicationDate *string `json:"publication_date"` // Use string to parse and validate date later
+		Genre           *string `json:"genre"`
+		Description     *string `json:"description"`
+		Language        *string `json:"language"`
+	}
 
 	// Decode the incoming JSON
 	err = a.readJSON(w, r, &incomingData)
@@ -149,19 +174,27 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 	if incomingData.Description != nil {
 		book.Description = *incomingData.Description
 	}
+	if incomingData.Language != nil {
+		book.Language = *incomingData.Language
+	}
 
 	// Validate the updated comment
 	v := validator.New()
-	data.ValidateBook(v, book)
+	data.ValidateBook(v, book, a.contentPolicy.Load())
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// Perform the update in the database
-	err = a.bookModel.Update(book)
+	err = a.bookModel.Update(book, &before, a.contextGetUser(r).ID)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -169,7 +202,9 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 	data := envelope{
 		"Book": book,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", bookETag(book))
+	err = a.writeJSON(w, http.StatusOK, data, headers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -183,7 +218,21 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	err = a.bookModel.Delete(id)
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.BIDnotFound(w, r, id) // Pass the ID to the custom message handler
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !a.checkExpectedVersion(w, r, int64(book.Version)) {
+		return
+	}
+
+	err = a.bookModel.Delete(book, a.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -206,6 +255,7 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *http.Request) {
 	//to hold query parameters
 	var queryParameterData struct {
+		Filter data.BookFilter
 		data.Filters
 	}
 
@@ -214,18 +264,21 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 
 	v := validator.New()
 
+	queryParameterData.Filter = a.readBookFilter(r, queryParameter, v)
 	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
 	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
 	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "id")
-	queryParameterData.Filters.SortSafeList = []string{"id", "title", "author", "genre", "-id", "-title", "-author", "-genre"}
+	queryParameterData.Filters.SortSafeList = []string{"id", "title", "authors", "genre", "weighted_rating", "-id", "-title", "-authors", "-genre", "-weighted_rating"}
+	a.readCursorParameters(queryParameter, &queryParameterData.Filters, v)
 
+	data.ValidateBookFilter(v, queryParameterData.Filter)
 	data.ValidateFilters(v, queryParameterData.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	books, metadata, err := a.bookModel.GetAll(queryParameterData.Filters)
+	books, metadata, err := a.bookModel.GetAll(queryParameterData.Filter, queryParameterData.Filters)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -236,12 +289,13 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 			return
 		}
 	}
+	a.signNextCursor(&metadata)
 	data := envelope{
 		"books":     books,
 		"@metadata": metadata,
 	}
 
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeCollectionJSON(w, r, data)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -251,9 +305,8 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 func (a *applicationDependencies) searchBookHandler(w http.ResponseWriter, r *http.Request) {
 	//to hold query parameters
 	var queryParameterData struct {
-		Title  string
-		Author string
-		Genre  string
+		Criteria data.BookSearchCriteria
+		Facets   []string
 		data.Filters
 	}
 
@@ -261,41 +314,79 @@ func (a *applicationDependencies) searchBookHandler(w http.ResponseWriter, r *ht
 	queryParameter := r.URL.Query()
 
 	//load the query parameters into the created struct
-	queryParameterData.Title = a.getSingleQueryParameter(queryParameter, "title", "")
-	queryParameterData.Author = a.getSingleQueryParameter(queryParameter, "author", "")
-	queryParameterData.Genre = a.getSingleQueryParameter(queryParameter, "genre", "")
 	v := validator.New()
+	queryParameterData.Criteria = a.readBookSearchCriteria(r, queryParameter, v)
+	queryParameterData.Facets = a.getMultipleQueryParameters(queryParameter, "facets", []string{})
+	slices.Sort(queryParameterData.Facets)
+	queryParameterData.Facets = slices.Compact(queryParameterData.Facets)
 
 	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
 	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
-	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "id")
-	queryParameterData.Filters.SortSafeList = []string{"id", "title", "author", "genre", "-id", "-title", "-author", "-genre"}
+	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "relevance")
+	queryParameterData.Filters.SortSafeList = []string{"relevance", "id", "title", "authors", "genre", "-id", "-title", "-authors", "-genre"}
+	a.readCursorParameters(queryParameter, &queryParameterData.Filters, v)
 
+	data.ValidateBookSearchCriteria(v, queryParameterData.Criteria)
+	for _, facet := range queryParameterData.Facets {
+		v.Check(validator.PermittedValue(facet, data.BookFacetNames...), "facets", "must contain only genre, decade, rating or language")
+	}
 	data.ValidateFilters(v, queryParameterData.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	books, metadata, err := a.bookModel.Search(queryParameterData.Title, queryParameterData.Author, queryParameterData.Genre, queryParameterData.Filters)
+	books, facets, metadata, err := a.bookModel.Search(queryParameterData.Criteria, queryParameterData.Facets, queryParameterData.Filters)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			a.notFoundResponse(w, r)
-			return
-		default:
-			a.serverErrorResponse(w, r, err)
-			return
-		}
+		a.serverErrorResponse(w, r, err)
+		return
 	}
+
+	a.signNextCursor(&metadata)
 	data := envelope{
 		"books":     books,
 		"@metadata": metadata,
 	}
 
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if len(queryParameterData.Facets) > 0 {
+		data["facets"] = facets
+	}
+	err = a.writeCollectionJSON(w, r, data)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
-		return
 	}
 }
+
+// readBookFilter reads the filters a book listing, search or export can
+// be narrowed down by. not_in_my_lists and status refer to the caller's
+// reading lists
+func (a *applicationDependencies) readBookFilter(r *http.Request, queryParameter url.Values, v *validator.Validator) data.BookFilter {
+	return data.BookFilter{
+		MinRating:    a.getSingleFloatParameter(queryParameter, "min_rating", 0, v),
+		MaxRating:    a.getSingleFloatParameter(queryParameter, "max_rating", 5, v),
+		MinReviews:   a.getSingleIntegerParameter(queryParameter, "min_reviews", 0, v),
+		NotInMyLists: a.getSingleBoolParameter(queryParameter, "not_in_my_lists", false, v),
+		ReviewedBy:   int64(a.getSingleIntegerParameter(queryParameter, "reviewed_by", 0, v)),
+		Status:       a.getSingleQueryParameter(queryParameter, "status", ""),
+		UserID:       a.contextGetUser(r).ID,
+	}
+}
+
+// readBookSearchCriteria reads the search query, the filters and the
+// facet values a search or export is narrowed down by. Several values for
+// a facet are separated by commas, e.g. genre=Fantasy,Horror
+func (a *applicationDependencies) readBookSearchCriteria(r *http.Request, queryParameter url.Values, v *validator.Validator) data.BookSearchCriteria {
+	criteria := data.BookSearchCriteria{
+		Query:      strings.TrimSpace(a.getSingleQueryParameter(queryParameter, "q", "")),
+		Language:   a.getSingleQueryParameter(queryParameter, "lang", "english"),
+		Facets:     make(map[string][]string),
+		BookFilter: a.readBookFilter(r, queryParameter, v),
+	}
+	for _, facet := range data.BookFacetNames {
+		values := a.getMultipleQueryParameters(queryParameter, facet, nil)
+		if len(values) > 0 {
+			criteria.Facets[facet] = values
+		}
+	}
+	return criteria
+}
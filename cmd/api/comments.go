@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// readCommentReview reads :rid and checks the review is there, and not
+// hidden from the user, to comment on. It writes the error response
+// itself and returns false if it isn't
+func (a *applicationDependencies) readCommentReview(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	reviewID, err := a.readIDParam(r, "rid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return 0, false
+	}
+
+	if _, ok := a.readVisibleReview(w, r, reviewID); !ok {
+		return 0, false
+	}
+	return reviewID, true
+}
+
+// readOwnComment reads the comment at :cid for an edit or a delete, which
+// only its author may make
+func (a *applicationDependencies) readOwnComment(w http.ResponseWriter, r *http.Request) (*data.Comment, bool) {
+	reviewID, ok := a.readCommentReview(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := a.readIDParam(r, "cid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	comment, err := a.commentModel.Get(reviewID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if comment.UserID == nil || *comment.UserID != a.contextGetUser(r).ID {
+		a.notPermittedResponse(w, r)
+		return nil, false
+	}
+	return comment, true
+}
+
+func (a *applicationDependencies) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, ok := a.readCommentReview(w, r)
+	if !ok {
+		return
+	}
+
+	var queryParameterData struct {
+		data.Filters
+	}
+
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 20, v)
+	queryParameterData.Filters.Sort = "created_at"
+	queryParameterData.Filters.SortSafeList = []string{"created_at"}
+	a.readCursorParameters(queryParameter, &queryParameterData.Filters, v)
+
+	data.ValidateFilters(v, queryParameterData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comments, metadata, err := a.commentModel.GetThread(reviewID, queryParameterData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	a.signNextCursor(&metadata)
+
+	data := envelope{
+		"comments":  comments,
+		"@metadata": metadata,
+	}
+	err = a.writeCollectionJSON(w, r, data)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, ok := a.readCommentReview(w, r)
+	if !ok {
+		return
+	}
+
+	var incomingData struct {
+		Body     string `json:"body"`
+		ParentID *int64 `json:"parent_id"` // set when replying to a comment
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	userID := a.contextGetUser(r).ID
+	comment := &data.Comment{
+		ReviewID: reviewID,
+		ParentID: incomingData.ParentID,
+		UserID:   &userID,
+		Body:     strings.TrimSpace(incomingData.Body),
+	}
+
+	v := validator.New()
+	data.ValidateComment(v, comment, a.contentPolicy.Load())
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.commentModel.Insert(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parent_id", "must be a comment on this review")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrCommentTooDeep):
+			v.AddError("parent_id", "the thread is too deep to reply to this comment")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/reviews/%d/comments/%d", reviewID, comment.ID))
+	headers.Set("ETag", strongETag(int64(comment.Version)))
+
+	data := envelope{
+		"comment": comment,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayCommentHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, ok := a.readCommentReview(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := a.readIDParam(r, "cid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	comment, err := a.commentModel.Get(reviewID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"comment": comment,
+	}
+	err = a.writeJSONWithETag(w, r, data, strongETag(int64(comment.Version)))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := a.readOwnComment(w, r)
+	if !ok {
+		return
+	}
+	if !a.checkExpectedVersion(w, r, int64(comment.Version)) {
+		return
+	}
+
+	var incomingData struct {
+		Body string `json:"body"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+	comment.Body = strings.TrimSpace(incomingData.Body)
+
+	v := validator.New()
+	data.ValidateComment(v, comment, a.contentPolicy.Load())
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.commentModel.Update(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", strongETag(int64(comment.Version)))
+
+	data := envelope{
+		"comment": comment,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := a.readOwnComment(w, r)
+	if !ok {
+		return
+	}
+	if !a.checkExpectedVersion(w, r, int64(comment.Version)) {
+		return
+	}
+
+	err := a.commentModel.Delete(comment.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "Comment successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
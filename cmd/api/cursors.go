@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/rand"
+	"net/url"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// readCursorParameters reads the cursor a page starts at and whether the
+// total number of records should be counted, which is left out by
+// default as it is slow on big tables
+func (a *applicationDependencies) readCursorParameters(queryParameter url.Values, filters *data.Filters, v *validator.Validator) {
+	filters.IncludeTotal = a.getSingleBoolParameter(queryParameter, "include_total", false, v)
+
+	token := queryParameter.Get("cursor")
+	if token == "" {
+		return
+	}
+	cursor, err := data.DecodeCursor(token, a.config.cursor.secret)
+	if err != nil {
+		v.AddError("cursor", "is not a valid cursor")
+		return
+	}
+	filters.Cursor = cursor
+}
+
+// signNextCursor turns the cursor for the next page into the token the
+// client sends back as ?cursor=
+func (a *applicationDependencies) signNextCursor(metadata *data.Metadata) {
+	if metadata.Next != nil {
+		metadata.NextCursor = metadata.Next.Encode(a.config.cursor.secret)
+	}
+}
+
+// newCursorSecret makes up a secret for when none is configured. Cursors
+// signed with it stop working when the server restarts
+func newCursorSecret() []byte {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		panic(err)
+	}
+	return secret
+}
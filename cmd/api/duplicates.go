@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+func (a *applicationDependencies) listDuplicateBooksHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParameterData struct {
+		MinScore float64
+		data.Filters
+	}
+
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	queryParameterData.MinScore = a.getSingleFloatParameter(queryParameter, "min_score", 0.5, v)
+	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 20, v)
+	queryParameterData.Filters.Sort = "score"
+	queryParameterData.Filters.SortSafeList = []string{"score"}
+
+	v.Check(queryParameterData.MinScore > 0 && queryParameterData.MinScore <= 1, "min_score", "must be greater than 0 and at most 1")
+	data.ValidateFilters(v, queryParameterData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	candidates, metadata, err := a.bookModel.FindDuplicates(queryParameterData.MinScore, queryParameterData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"duplicates": candidates,
+		"@metadata":  metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) mergeBooksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "bid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		DuplicateIDs []int64 `json:"duplicate_ids"` // merged into :bid and removed
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	slices.Sort(incomingData.DuplicateIDs)
+	incomingData.DuplicateIDs = slices.Compact(incomingData.DuplicateIDs)
+
+	v := validator.New()
+	v.Check(len(incomingData.DuplicateIDs) > 0, "duplicate_ids", "must contain at least one book id")
+	v.Check(len(incomingData.DuplicateIDs) <= 50, "duplicate_ids", "must not contain more than 50 book ids")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book, err := a.bookModel.Merge(id, incomingData.DuplicateIDs, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMergeIntoSelf):
+			v.AddError("duplicate_ids", err.Error())
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"Book": book,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -88,6 +88,23 @@ func (a *applicationDependencies) editConflictResponse(w http.ResponseWriter, r
 	a.errorResponseJSON(w, r, http.StatusConflict, message)
 }
 
+func (a *applicationDependencies) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has changed since you last fetched it, please fetch it again"
+	a.errorResponseJSON(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (a *applicationDependencies) duplicateReviewResponse(w http.ResponseWriter, r *http.Request, bookID int64) {
+	message := fmt.Sprintf("this user has already reviewed the book, use PUT /api/v1/books/%d/reviews/mine to replace the review", bookID)
+	a.errorResponseJSON(w, r, http.StatusConflict, message)
+}
+
+func (a *applicationDependencies) metadataUnavailableResponse(w http.ResponseWriter, r *http.Request, err error) {
+	a.logError(r, err)
+
+	message := "the book metadata service is unavailable, please try again later"
+	a.errorResponseJSON(w, r, http.StatusServiceUnavailable, message)
+}
+
 func (a *applicationDependencies) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	a.errorResponseJSON(w, r, http.StatusUnauthorized, message)
@@ -110,3 +127,8 @@ func (a *applicationDependencies) inactiveAccountResponse(w http.ResponseWriter,
 	message := "your user account must be activated to access this resource"
 	a.errorResponseJSON(w, r, http.StatusForbidden, message)
 }
+
+func (a *applicationDependencies) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	a.errorResponseJSON(w, r, http.StatusForbidden, message)
+}
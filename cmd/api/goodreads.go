@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// the name of the reading list that Goodreads shelves are copied into
+const goodreadsListName = "Goodreads"
+
+// how often (in rows) a running import saves its progress
+const importProgressEvery = 25
+
+// Goodreads "Exclusive Shelf" values and the reading status they become
+var goodreadsShelves = map[string]string{
+	"read":              "completed",
+	"currently-reading": "currently reading",
+	"to-read":           "want to read",
+}
+
+// One row of a Goodreads library export with only the columns we use
+type goodreadsEntry struct {
+	Row               int
+	Title             string
+	Author            string
+	AdditionalAuthors string
+	ISBN              string
+	ISBN13            string
+	MyRating          int64
+	MyReview          string
+	ExclusiveShelf    string
+}
+
+func (a *applicationDependencies) importGoodreadsHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	body, err := a.uploadedFile(w, r)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+	defer body.Close()
+
+	entries, err := readGoodreadsCSV(body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("the body must not be larger that %d bytes", maxBytesError.Limit)
+		}
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	job := &data.ImportJob{
+		UserID:    user.ID,
+		Source:    "goodreads",
+		Status:    data.ImportJobPending,
+		TotalRows: len(entries),
+	}
+	err = a.importJobModel.Insert(job)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the import makes several queries per row so it runs in the
+	// background and the client polls the job for progress. It updates
+	// the job as it goes, so the response is written from a copy
+	accepted := *job
+	a.background(func() {
+		a.runGoodreadsImport(job, entries)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/imports/%d", job.ID))
+
+	data := envelope{
+		"import": accepted,
+	}
+	err = a.writeJSON(w, http.StatusAccepted, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayImportJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "jid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	job, err := a.importJobModel.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"import": job,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// uploadedFile returns the file sent by the client. Browsers send it as
+// the "file" field of a multipart form, other clients can just post the
+// CSV as the body
+func (a *applicationDependencies) uploadedFile(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	err := r.ParseMultipartForm(maxImportBytes)
+	if err != nil {
+		return nil, err
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, errors.New("the form must contain a \"file\" field")
+	}
+	return file, nil
+}
+
+func readGoodreadsCSV(body io.Reader) ([]goodreadsEntry, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the body must not be empty")
+		}
+		return nil, fmt.Errorf("unable to read the CSV header: %w", err)
+	}
+
+	positions := make(map[string]int)
+	for i, name := range header {
+		positions[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, name := range []string{"Title", "Author", "ISBN13", "My Rating", "Exclusive Shelf"} {
+		if _, found := positions[name]; !found {
+			return nil, fmt.Errorf("this does not look like a Goodreads export, the %q column is missing", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, found := positions[name]
+		if !found || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	entries := []goodreadsEntry{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+
+		rating, _ := strconv.ParseInt(field(record, "My Rating"), 10, 64)
+		entries = append(entries, goodreadsEntry{
+			Row:               row,
+			Title:             field(record, "Title"),
+			Author:            field(record, "Author"),
+			AdditionalAuthors: field(record, "Additional Authors"),
+			ISBN:              goodreadsISBN(field(record, "ISBN")),
+			ISBN13:            goodreadsISBN(field(record, "ISBN13")),
+			MyRating:          rating,
+			MyReview:          goodreadsReviewText(field(record, "My Review")),
+			ExclusiveShelf:    field(record, "Exclusive Shelf"),
+		})
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("the export does not contain any books")
+	}
+	return entries, nil
+}
+
+// Goodreads writes ISBNs as ="0439023483" so spreadsheets keep the
+// leading zeros. Strip that back off
+func goodreadsISBN(value string) string {
+	value = strings.TrimPrefix(value, "=")
+	return strings.Trim(value, `"`)
+}
+
+// Goodreads stores review text as HTML with <br/> for line breaks
+func goodreadsReviewText(value string) string {
+	replacer := strings.NewReplacer("<br/>", "\n", "<br />", "\n", "<br>", "\n")
+	return strings.TrimSpace(replacer.Replace(value))
+}
+
+// runGoodreadsImport works through the rows of the export and keeps the
+// job updated as it goes. A problem with one row is recorded on the job
+// and the import moves on to the next one
+func (a *applicationDependencies) runGoodreadsImport(job *data.ImportJob, entries []goodreadsEntry) {
+	job.Status = data.ImportJobRunning
+	a.saveImportJob(job)
+
+	list, err := a.readingListModel.GetOrCreateByName(job.UserID, goodreadsListName, "Shelves imported from Goodreads")
+	if err != nil {
+		a.logger.Error(err.Error(), "import_job", job.ID)
+		job.Status = data.ImportJobFailed
+		job.AddError(0, "unable to create the Goodreads reading list")
+		a.saveImportJob(job)
+		return
+	}
+
+	for _, entry := range entries {
+		err := a.importGoodreadsEntry(job, list, entry)
+		if err != nil {
+			job.AddError(entry.Row, err.Error())
+		}
+
+		job.ProcessedRows++
+		if job.ProcessedRows%importProgressEvery == 0 {
+			a.saveImportJob(job)
+		}
+	}
+
+	job.Status = data.ImportJobCompleted
+	a.saveImportJob(job)
+}
+
+func (a *applicationDependencies) importGoodreadsEntry(job *data.ImportJob, list *data.ReadingList, entry goodreadsEntry) error {
+	isbn := data.ISBN13(entry.ISBN13)
+	if isbn == "" {
+		isbn = data.ISBN13(entry.ISBN)
+	}
+
+	// find the book in our catalog by ISBN first, then by title and
+	// author, and only add it when neither works
+	var book *data.Book
+	var err error
+	if isbn != "" {
+		book, err = a.bookModel.FindByISBN(isbn)
+	}
+	if book == nil && entry.Title != "" && entry.Author != "" {
+		book, err = a.bookModel.FindByTitleAndAuthor(entry.Title, entry.Author)
+	}
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return err
+	}
+
+	if book != nil {
+		job.BooksMatched++
+	} else {
+		if isbn == "" {
+			return errors.New("the book is not in the catalog and has no ISBN to add it with")
+		}
+		authors := entry.Author
+		if entry.AdditionalAuthors != "" {
+			authors += ", " + entry.AdditionalAuthors
+		}
+		book = &data.Book{
+			Title:   entry.Title,
+			Authors: authors,
+			ISBN:    isbn,
+		}
+		v := validator.New()
+		data.ValidateImportedBook(v, book, a.contentPolicy.Load())
+		if !v.IsEmpty() {
+			return validationError("book", v.Errors)
+		}
+		err = a.bookModel.Insert(book, job.UserID)
+		if err != nil {
+			return err
+		}
+		job.BooksCreated++
+	}
+
+	if status, found := goodreadsShelves[entry.ExclusiveShelf]; found {
+		err = a.readingListModel.SetBookStatus(&data.BooksInList{
+			ReadingListID: list.ID,
+			BookID:        book.ID,
+			Status:        status,
+		})
+		if err != nil {
+			return err
+		}
+		job.ListEntries++
+	}
+
+	// Goodreads uses 0 for "not rated"
+	if entry.MyRating >= 1 && entry.MyRating <= 5 {
+		reviewed, err := a.reviewModel.HasReviewed(book.ID, job.UserID)
+		if err != nil {
+			return err
+		}
+		if !reviewed {
+			review := &data.Review{
+				BookID:     book.ID,
+				UserID:     job.UserID,
+				Rating:     entry.MyRating,
+				ReviewText: entry.MyReview,
+			}
+			v := validator.New()
+			data.ValidateImportedReview(v, review, a.contentPolicy.Load())
+			if !v.IsEmpty() {
+				return validationError("review", v.Errors)
+			}
+			err = a.reviewModel.InsertReview(review, job.UserID)
+			if err != nil {
+				return err
+			}
+			job.ReviewsCreated++
+		}
+	}
+
+	return nil
+}
+
+// validationError turns the validation errors for what a row would have
+// created into the error recorded for the row
+func validationError(what string, fieldErrors map[string]string) error {
+	fields := make([]string, 0, len(fieldErrors))
+	for field := range fieldErrors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	problems := make([]string, len(fields))
+	for i, field := range fields {
+		problems[i] = field + " " + fieldErrors[field]
+	}
+	return fmt.Errorf("the %s was not imported: %s", what, strings.Join(problems, "; "))
+}
+
+func (a *applicationDependencies) saveImportJob(job *data.ImportJob) {
+	err := a.importJobModel.Update(job)
+	if err != nil {
+		a.logger.Error(err.Error(), "import_job", job.ID)
+	}
+}
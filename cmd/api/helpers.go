@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mtechguy/test3/internal/validator"
 
@@ -133,14 +134,14 @@ func (a *applicationDependencies) getSingleQueryParameter(queryParameters url.Va
 	return result
 }
 
-// func (a *applicationDependencies) getMultipleQueryParameters(queryParameters url.Values, key string, defaultValue []string) []string {
+func (a *applicationDependencies) getMultipleQueryParameters(queryParameters url.Values, key string, defaultValue []string) []string {
 
-// 	result := queryParameters.Get(key)
-// 	if result == "" {
-// 		return defaultValue
-// 	}
-// 	return strings.Split(result, ",")
-// }
+	result := queryParameters.Get(key)
+	if result == "" {
+		return defaultValue
+	}
+	return strings.Split(result, ",")
+}
 
 func (a *applicationDependencies) getSingleIntegerParameter(queryParameters url.Values, key string, defaultValue int, v *validator.Validator) int {
 
@@ -157,6 +158,39 @@ func (a *applicationDependencies) getSingleIntegerParameter(queryParameters url.
 
 	return intValue
 }
+
+func (a *applicationDependencies) getSingleFloatParameter(queryParameters url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+
+	result := queryParameters.Get(key)
+	if result == "" {
+		return defaultValue
+	}
+	// try to convert to a number
+	floatValue, err := strconv.ParseFloat(result, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+
+	return floatValue
+}
+
+func (a *applicationDependencies) getSingleBoolParameter(queryParameters url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+
+	result := queryParameters.Get(key)
+	if result == "" {
+		return defaultValue
+	}
+	// try to convert to a boolean
+	boolValue, err := strconv.ParseBool(result)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return defaultValue
+	}
+
+	return boolValue
+}
+
 func (a *applicationDependencies) background(fn func()) {
 	a.wg.Add(1) // Use a wait group to ensure all goroutines finish before we exit
 	go func() {
@@ -170,3 +204,21 @@ func (a *applicationDependencies) background(fn func()) {
 		fn() // Run the actual function
 	}()
 }
+
+// backgroundEvery runs fn in the background every interval until the
+// server starts shutting down
+func (a *applicationDependencies) backgroundEvery(interval time.Duration, fn func()) {
+	a.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.shutdown.Done():
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/metadata"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// lookupBookHandler returns a Book prefilled from the metadata provider.
+// Nothing is saved, the client reviews the data and sends it on to
+// createBookHandler
+func (a *applicationDependencies) lookupBookHandler(w http.ResponseWriter, r *http.Request) {
+	isbn := data.ISBN13(a.getSingleQueryParameter(r.URL.Query(), "isbn", ""))
+
+	v := validator.New()
+	v.Check(isbn != "", "isbn", "must be a valid 10 or 13 digit ISBN")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book := &data.Book{ISBN: isbn}
+	err := a.enrichBook(r.Context(), book)
+	if err != nil {
+		switch {
+		case errors.Is(err, metadata.ErrNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.metadataUnavailableResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"Book": book,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// enrichBook fills in the fields of book that are still empty using
+// the metadata provider. Fields the client already sent are kept
+func (a *applicationDependencies) enrichBook(ctx context.Context, book *data.Book) error {
+	ctx, cancel := context.WithTimeout(ctx, a.config.metadata.timeout)
+	defer cancel()
+
+	record, err := a.metadata.LookupISBN(ctx, book.ISBN)
+	if err != nil {
+		return err
+	}
+
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&book.Title, record.Title)
+	fill(&book.Authors, record.Authors)
+	fill(&book.PublicationDate, publicationDate(record.PublicationDate))
+	fill(&book.Genre, record.Genre)
+	fill(&book.Description, truncateText(record.Description, maxDescriptionBytes))
+
+	return nil
+}
+
+// how long a book description can be, as ValidateBook checks it
+const maxDescriptionBytes = 200
+
+// the ways providers write a full publication date
+var publicationDateLayouts = []string{"January 2, 2006", "Jan 2, 2006", "2 January 2006", "2 Jan 2006", "2006-01-02", "01/02/2006"}
+
+// publicationDate turns a provider's publication date into the "July 12,
+// 2020" form books use. Partial dates such as "2008" or "Mar 2008" can't
+// be written that way and come back empty, for the client to fill in
+func publicationDate(value string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range publicationDateLayouts {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date.Format("January 2, 2006")
+		}
+	}
+	return ""
+}
+
+// truncateText cuts text down to at most max bytes, at the last space
+// that fits when there is one, and marks the cut with an ellipsis
+func truncateText(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	const ellipsis = "…"
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if space := strings.LastIndexByte(text[:cut], ' '); space > 0 {
+		cut = space
+	}
+	return strings.TrimRight(text[:cut], " ,.;:") + ellipsis
+}
+
+// the cached metadata provider used by the application
+func newMetadataProvider(setting serverConfig, cache metadata.Cache) metadata.Provider {
+	provider := metadata.NewOpenLibrary(setting.metadata.url, setting.metadata.timeout)
+	return metadata.Cached{
+		Provider: provider,
+		Cache:    cache,
+		MaxAge:   setting.metadata.cacheTTL,
+	}
+}
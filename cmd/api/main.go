@@ -7,11 +7,14 @@ import (
 	"log/slog"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/mtechguy/test3/internal/data"
 	"github.com/mtechguy/test3/internal/mailer"
+	"github.com/mtechguy/test3/internal/metadata"
+	"github.com/mtechguy/test3/internal/policy"
 )
 
 const appVersion = "7.0.0"
@@ -34,6 +37,24 @@ type serverConfig struct {
 		password string
 		sender   string
 	}
+	metadata struct {
+		url      string        // base URL of an Open Library compatible API
+		timeout  time.Duration // how long a lookup may take
+		cacheTTL time.Duration // how long a cached lookup stays fresh
+	}
+	trash struct {
+		retention     time.Duration // how long deleted items can be restored
+		purgeInterval time.Duration // how often expired items are removed
+	}
+	search struct {
+		suggestRefresh time.Duration // how often search suggestions are rebuilt
+	}
+	cursor struct {
+		secret []byte // signs the pagination cursors handed to clients
+	}
+	contentPolicy struct {
+		file string // JSON file the content policy is read from, none if empty
+	}
 }
 
 type applicationDependencies struct {
@@ -45,7 +66,19 @@ type applicationDependencies struct {
 	userModel        data.UserModel
 	mailer           mailer.Mailer
 	wg               sync.WaitGroup
+	shutdown         context.Context // done once the server starts shutting down
+	stopBackground   context.CancelFunc
 	tokenModel       data.TokenModel
+	importJobModel   data.ImportJobModel
+	permissionModel  data.PermissionModel
+	workModel        data.WorkModel
+	seriesModel      data.SeriesModel
+	trashModel       data.TrashModel
+	revisionModel    data.RevisionModel
+	suggestionModel  data.SuggestionModel
+	commentModel     data.CommentModel
+	metadata         metadata.Provider
+	contentPolicy    atomic.Pointer[policy.Policy] // nil when there is none, swapped on reload
 }
 
 func main() {
@@ -71,10 +104,41 @@ func main() {
 
 	flag.StringVar(&setting.smtp.sender, "smtp-sender", "Book Club Management Community <no-reply@commentscommunity.alexperaza.net>", "SMTP sender")
 
+	flag.StringVar(&setting.metadata.url, "metadata-url", "https://openlibrary.org", "Book metadata provider base URL (Open Library compatible)")
+	flag.DurationVar(&setting.metadata.timeout, "metadata-timeout", 5*time.Second, "Book metadata lookup timeout")
+	flag.DurationVar(&setting.metadata.cacheTTL, "metadata-cache-ttl", 30*24*time.Hour, "How long looked up book metadata is cached")
+
+	flag.DurationVar(&setting.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted books, lists and reviews can be restored")
+	flag.DurationVar(&setting.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often expired items are purged from the trash")
+
+	flag.DurationVar(&setting.search.suggestRefresh, "suggest-refresh-interval", 5*time.Minute, "How often search suggestions are rebuilt")
+
+	var cursorSecret string
+	flag.StringVar(&cursorSecret, "cursor-secret", "", "Secret pagination cursors are signed with (random if empty)")
+
+	flag.StringVar(&setting.contentPolicy.file, "content-policy", "", "Content policy file reviews, comments and descriptions are checked against")
+
 	flag.Parse()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	setting.cursor.secret = []byte(cursorSecret)
+	if cursorSecret == "" {
+		logger.Warn("no cursor secret given, pagination cursors will not survive a restart")
+		setting.cursor.secret = newCursorSecret()
+	}
+
+	var contentPolicy *policy.Policy
+	if setting.contentPolicy.file != "" {
+		var err error
+		contentPolicy, err = policy.Load(setting.contentPolicy.file)
+		if err != nil {
+			logger.Error("Content policy failed to load", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Content policy loaded", "file", setting.contentPolicy.file)
+	}
+
 	// the call to openDB() sets up our connection pool
 	db, err := openDB(setting)
 	if err != nil {
@@ -86,18 +150,36 @@ func main() {
 
 	logger.Info("Database connection pool established")
 
+	shutdown, stopBackground := context.WithCancel(context.Background())
+
 	appInstance := &applicationDependencies{
 		config:           setting,
+		shutdown:         shutdown,
+		stopBackground:   stopBackground,
 		logger:           logger,
 		userModel:        data.UserModel{DB: db},
 		bookModel:        data.BookModel{DB: db},
 		readingListModel: data.ReadingListModel{DB: db},
 		reviewModel:      data.ReviewModel{DB: db},
 		tokenModel:       data.TokenModel{DB: db},
+		importJobModel:   data.ImportJobModel{DB: db},
+		permissionModel:  data.PermissionModel{DB: db},
+		workModel:        data.WorkModel{DB: db},
+		seriesModel:      data.SeriesModel{DB: db},
+		trashModel:       data.TrashModel{DB: db},
+		revisionModel:    data.RevisionModel{DB: db},
+		suggestionModel:  data.SuggestionModel{DB: db},
+		commentModel:     data.CommentModel{DB: db},
+		metadata:         newMetadataProvider(setting, data.MetadataCacheModel{DB: db}),
 		mailer: mailer.New(setting.smtp.host, setting.smtp.port,
 			setting.smtp.username, setting.smtp.password, setting.smtp.sender),
 	}
 
+	appInstance.contentPolicy.Store(contentPolicy)
+
+	appInstance.purgeTrash()
+	appInstance.refreshSuggestions()
+
 	err = appInstance.serve()
 	if err != nil {
 		logger.Error(err.Error())
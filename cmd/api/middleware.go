@@ -161,3 +161,26 @@ func (a *applicationDependencies) requireActivatedUser(next http.HandlerFunc) ht
 	// Chain the activated user check after ensuring the user is authenticated
 	return a.requireAuthenticatedUser(fn)
 }
+
+func (a *applicationDependencies) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+
+		user := a.contextGetUser(r)
+
+		permissions, err := a.permissionModel.GetAllForUser(user.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			// Send 403 Forbidden for users without the permission
+			a.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+
+	// Only activated users can hold a permission
+	return a.requireActivatedUser(fn)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// canSeeHiddenReview reports whether the user may still see a review a
+// moderator has hidden, which only its author and moderators can
+func (a *applicationDependencies) canSeeHiddenReview(user *data.User, review *data.Review) (bool, error) {
+	if user.ID == review.UserID {
+		return true, nil
+	}
+	permissions, err := a.permissionModel.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+	return permissions.Include(data.PermissionReviewsModerate), nil
+}
+
+// readVisibleReview reads the review with the id for the user. A hidden
+// review is treated as not found by everyone who can't see it, so it
+// can't be commented on, voted on or flagged either. It writes the error
+// response itself and returns false if there is no review to show
+func (a *applicationDependencies) readVisibleReview(w http.ResponseWriter, r *http.Request, id int64) (*data.Review, bool) {
+	review, err := a.reviewModel.GetReview(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.RIDnotFound(w, r, id)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	if review.Hidden {
+		visible, err := a.canSeeHiddenReview(a.contextGetUser(r), review)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+		if !visible {
+			a.RIDnotFound(w, r, id)
+			return nil, false
+		}
+	}
+	return review, true
+}
+
+func (a *applicationDependencies) flagReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r, "rid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, ok := a.readVisibleReview(w, r, reviewID)
+	if !ok {
+		return
+	}
+
+	var incomingData struct {
+		Reason string `json:"reason"`
+		Note   string `json:"note"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := a.contextGetUser(r)
+	flag := &data.ReviewFlag{
+		ReviewID: review.ReviewID,
+		UserID:   user.ID,
+		Reason:   incomingData.Reason,
+		Note:     strings.TrimSpace(incomingData.Note),
+	}
+
+	v := validator.New()
+	v.Check(review.UserID != user.ID, "review", "you can't flag your own review")
+	data.ValidateReviewFlag(v, flag)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.reviewModel.InsertFlag(flag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateFlag):
+			v.AddError("review", "you have already flagged this review")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"flag": flag,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) moderationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParameterData struct {
+		data.Filters
+	}
+
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 20, v)
+	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "-flag_count")
+	queryParameterData.Filters.SortSafeList = []string{"flag_count", "first_flagged_at", "-flag_count", "-first_flagged_at"}
+	a.readCursorParameters(queryParameter, &queryParameterData.Filters, v)
+
+	data.ValidateFilters(v, queryParameterData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items, metadata, err := a.reviewModel.GetModerationQueue(queryParameterData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	a.signNextCursor(&metadata)
+	for _, item := range items {
+		item.Review.RenderText(false)
+	}
+
+	data := envelope{
+		"reviews":   items,
+		"@metadata": metadata,
+	}
+	err = a.writeCollectionJSON(w, r, data)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// how each moderation action is described to the moderator and the author
+var moderationOutcomes = map[string]string{
+	data.ModerationHide:    "hidden",
+	data.ModerationRestore: "restored",
+	data.ModerationDelete:  "deleted",
+}
+
+func (a *applicationDependencies) moderateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r, "rid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := a.reviewModel.GetReview(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.RIDnotFound(w, r, reviewID)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var incomingData struct {
+		Action string `json:"action"`
+		Note   string `json:"note"` // passed on to the author
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+	note := strings.TrimSpace(incomingData.Note)
+
+	v := validator.New()
+	v.Check(incomingData.Action != "", "action", "must be provided")
+	v.Check(validator.PermittedValue(incomingData.Action, data.ModerationActions...), "action", "must be hide, restore or delete")
+	v.Check(len(note) <= 1000, "note", "must not be more than 1000 bytes long")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	moderator := a.contextGetUser(r)
+	err = a.reviewModel.Moderate(review, moderator.ID, incomingData.Action)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.notifyReviewAuthor(review, incomingData.Action, note)
+
+	data := envelope{
+		"message": fmt.Sprintf("Review successfully %s", moderationOutcomes[incomingData.Action]),
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// notifyReviewAuthor emails the author of a review about what a moderator
+// did with it. It runs in the background; failures are only logged
+func (a *applicationDependencies) notifyReviewAuthor(review *data.Review, action string, note string) {
+	a.background(func() {
+		author, err := a.userModel.GetByID(review.UserID)
+		if err != nil {
+			a.logger.Error(err.Error())
+			return
+		}
+
+		bookTitle := ""
+		book, err := a.bookModel.Get(review.BookID)
+		if err == nil {
+			bookTitle = book.Title
+		}
+
+		templateData := map[string]any{
+			"outcome":   moderationOutcomes[action],
+			"hidden":    action == data.ModerationHide,
+			"bookTitle": bookTitle,
+			"note":      note,
+			"reviewID":  review.ReviewID,
+		}
+		err = a.mailer.Send(author.Email, "review_moderated.tmpl", templateData)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/mtechguy/test3/internal/policy"
+)
+
+func (a *applicationDependencies) displayContentPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	data := envelope{
+		"file":           a.config.contentPolicy.file,
+		"content_policy": a.contentPolicy.Load().Summary(),
+	}
+	err := a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// reloadContentPolicyHandler reads the content policy file again. A file
+// that doesn't load leaves the policy in use as it was
+func (a *applicationDependencies) reloadContentPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if a.config.contentPolicy.file == "" {
+		a.errorResponseJSON(w, r, http.StatusConflict, "the server was started without a content policy file")
+		return
+	}
+
+	contentPolicy, err := policy.Load(a.config.contentPolicy.file)
+	if err != nil {
+		a.failedValidationResponse(w, r, map[string]string{"content_policy": err.Error()})
+		return
+	}
+	a.contentPolicy.Store(contentPolicy)
+	a.logger.Info("Content policy reloaded", "file", a.config.contentPolicy.file, "user_id", a.contextGetUser(r).ID)
+
+	data := envelope{
+		"message":        "content policy reloaded",
+		"content_policy": contentPolicy.Summary(),
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mtechguy/test3/internal/data"
+)
+
+// strongETag is the ETag of a single record. The version changes on every
+// edit, but derived values such as a book's average rating change without
+// touching the version, so those are hashed into the tag as well
+func strongETag(version int64, derived ...any) string {
+	tag := strconv.FormatInt(version, 10)
+	if len(derived) > 0 {
+		h := fnv.New32a()
+		fmt.Fprint(h, derived...)
+		tag += "-" + strconv.FormatUint(uint64(h.Sum32()), 16)
+	}
+	return strconv.Quote(tag)
+}
+
+func bookETag(book *data.Book) string {
+	return strongETag(int64(book.Version), book.AverageRating, book.WorkID)
+}
+
+// votes and comments change a review's tallies without touching its
+// version. hideSpoilers is part of the tag because the same version of a
+// review is sent with its spoilers shown or hidden
+func reviewETag(review *data.Review, hideSpoilers bool) string {
+	return strongETag(int64(review.Version), review.HelpfulVotes, review.UnhelpfulVotes, review.CommentCount, hideSpoilers)
+}
+
+// weakETag is the ETag of a page of a collection, worked out from what
+// is about to be sent back
+func weakETag(data envelope) (string, error) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(js)
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`, nil
+}
+
+// writeJSONWithETag sends data along with its ETag, or only a 304 Not
+// Modified when the client already has that ETag in If-None-Match
+func (a *applicationDependencies) writeJSONWithETag(w http.ResponseWriter, r *http.Request, data envelope, etag string) error {
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	return a.writeJSON(w, http.StatusOK, data, nil)
+}
+
+// writeCollectionJSON sends a page of a collection with a weak ETag
+func (a *applicationDependencies) writeCollectionJSON(w http.ResponseWriter, r *http.Request, data envelope) error {
+	etag, err := weakETag(data)
+	if err != nil {
+		return err
+	}
+	return a.writeJSONWithETag(w, r, data, etag)
+}
+
+// ifNoneMatch reports whether an If-None-Match header matches the ETag.
+// If-None-Match uses the weak comparison, so W/ prefixes are ignored
+func ifNoneMatch(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExpectedVersion lets a client assert which version of a record its
+// edit is based on, either with X-Expected-Version: 3 or with If-Match and
+// the ETag it was given. It compares that with the version we just read
+// and, when they differ, writes the error response and returns false. The
+// update query checks the version again, which catches anyone who got in
+// between
+func (a *applicationDependencies) checkExpectedVersion(w http.ResponseWriter, r *http.Request, current int64) bool {
+	if value := r.Header.Get("If-Match"); value != "" && !ifMatch(value, current) {
+		a.preconditionFailedResponse(w, r)
+		return false
+	}
+
+	if value := r.Header.Get("X-Expected-Version"); value != "" {
+		expected, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || expected < 1 {
+			a.badRequestResponse(w, r, errors.New("the X-Expected-Version header must be a positive integer"))
+			return false
+		}
+		if expected != current {
+			a.editConflictResponse(w, r)
+			return false
+		}
+	}
+
+	return true
+}
+
+// ifMatch reports whether an If-Match header matches the version. Only
+// the version part of an ETag is compared, since the derived values
+// hashed into it are not something the client can edit. Weak tags never
+// match because If-Match uses the strong comparison
+func ifMatch(header string, version int64) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		tag, err := strconv.Unquote(candidate)
+		if err != nil || strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		tagVersion, _, _ := strings.Cut(tag, "-")
+		if tagVersion == strconv.FormatInt(version, 10) {
+			return true
+		}
+	}
+	return false
+}
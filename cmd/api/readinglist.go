@@ -10,13 +10,6 @@ import (
 	"github.com/mtechguy/test3/internal/validator"
 )
 
-// Create a local struct to hold incoming data
-var incomingListData struct {
-	Name        *string `json:"name"`
-	Description *string `json:"description"`
-	CreatedBy   *int    `json:"created_by"`
-}
-
 func (a *applicationDependencies) createReadingListHandler(w http.ResponseWriter, r *http.Request) {
 	// Create a struct to hold incoming data with the correct field names and JSON tags
 	var incomingListData struct {
@@ -40,14 +33,14 @@ func (a *applicationDependencies) createReadingListHandler(w http.ResponseWriter
 
 	// Initialize a Validator instance
 	v := validator.New()
-	data.ValidateReadingList(v, list)
+	data.ValidateReadingList(v, list, a.contentPolicy.Load())
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// Insert the reading list into the database
-	err = a.readingListModel.Insert(list)
+	err = a.readingListModel.Insert(list, a.contextGetUser(r).ID)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -85,6 +78,17 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 		}
 		return
 	}
+	if !a.checkExpectedVersion(w, r, int64(list.Version)) {
+		return
+	}
+	before := *list
+
+	// Create a local struct to hold incoming data
+	var incomingListData struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		CreatedBy   *int    `json:"created_by"`
+	}
 
 	err = a.readJSON(w, r, &incomingListData)
 	if err != nil {
@@ -105,16 +109,21 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 
 	// Validate the updated reading list
 	v := validator.New()
-	data.ValidateReadingList(v, list)
+	data.ValidateReadingList(v, list, a.contentPolicy.Load())
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// Perform the update in the database
-	err = a.readingListModel.Update(list)
+	err = a.readingListModel.Update(list, &before, a.contextGetUser(r).ID)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -122,7 +131,9 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 	data := envelope{
 		"Reading List": list,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", strongETag(int64(list.Version)))
+	err = a.writeJSON(w, http.StatusOK, data, headers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -151,7 +162,7 @@ func (a *applicationDependencies) displayReadingListHandler(w http.ResponseWrite
 	data := envelope{
 		"Reading List": list,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSONWithETag(w, r, data, strongETag(int64(list.Version)))
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -166,11 +177,25 @@ func (a *applicationDependencies) deleteReadingListHandler(w http.ResponseWriter
 		return
 	}
 
-	err = a.readingListModel.Delete(id)
+	list, err := a.readingListModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.LIDnotFound(w, r, id)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !a.checkExpectedVersion(w, r, int64(list.Version)) {
+		return
+	}
+
+	err = a.readingListModel.Delete(list, a.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			a.BIDnotFound(w, r, id) // Pass the ID to the custom message handler
+			a.LIDnotFound(w, r, id)
 		default:
 			a.serverErrorResponse(w, r, err)
 		}
@@ -210,8 +235,9 @@ func (a *applicationDependencies) ReadinglistHandler(w http.ResponseWriter, r *h
 	queryParametersData.Filters.Sort = a.getSingleQueryParameter(
 		queryParameters, "sort", "id")
 
-	queryParametersData.Filters.SortSafeList = []string{"id", "name", "status",
-		"-id", "-name", "-status"}
+	queryParametersData.Filters.SortSafeList = []string{"id", "name",
+		"-id", "-name"}
+	a.readCursorParameters(queryParameters, &queryParametersData.Filters, v)
 
 	// Check if our filters are valid
 	data.ValidateFilters(v, queryParametersData.Filters)
@@ -228,11 +254,12 @@ func (a *applicationDependencies) ReadinglistHandler(w http.ResponseWriter, r *h
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	a.signNextCursor(&metadata)
 	data := envelope{
 		"Reading Lists": lists,
 		"@metadata":     metadata,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeCollectionJSON(w, r, data)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// listReviewRevisionsHandler shows the versions of a review's rating and
+// text from its revision history, newest first
+func (a *applicationDependencies) listReviewRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r, "rid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, ok := a.readVisibleReview(w, r, reviewID)
+	if !ok {
+		return
+	}
+
+	var queryParameterData struct {
+		data.Filters
+	}
+
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 20, v)
+	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "-version")
+	queryParameterData.Filters.SortSafeList = []string{"version", "-version"}
+	a.readCursorParameters(queryParameter, &queryParameterData.Filters, v)
+	hideSpoilers := a.getSingleBoolParameter(queryParameter, "hide_spoilers", false, v)
+
+	data.ValidateFilters(v, queryParameterData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := a.reviewModel.GetRevisions(review.ReviewID, queryParameterData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	a.signNextCursor(&metadata)
+	for _, revision := range revisions {
+		revision.RenderText(hideSpoilers)
+	}
+
+	data := envelope{
+		"revisions": revisions,
+		"@metadata": metadata,
+	}
+	err = a.writeCollectionJSON(w, r, data)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
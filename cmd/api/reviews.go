@@ -4,19 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	// import the data package which contains the definition for Comment
 	"github.com/mtechguy/test3/internal/data"
 	"github.com/mtechguy/test3/internal/validator"
-)
 
-// Struct to hold incoming review data
-var incomingReviewData struct {
-	Rating     *int64  `json:"rating"` // integer with a constraint (1-5)
-	ReviewText *string `json:"review"` // non-null text field
-}
+	"github.com/julienschmidt/httprouter"
+)
 
 // Updated createReviewHandler with product existence check
 func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *http.Request) {
@@ -29,7 +26,6 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 
 	// Create a local instance of incomingReviewData
 	var incomingReviewData struct {
-		UserID     *int64  `json:"user_id"`
 		Rating     *int64  `json:"rating"` // FLOAT with a constraint (1-5)
 		ReviewText *string `json:"review"` // Non-null text field
 	}
@@ -42,10 +38,6 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 	}
 
 	// Check if required fields are provided
-	if incomingReviewData.UserID == nil {
-		a.badRequestResponse(w, r, errors.New("user_id is required"))
-		return
-	}
 	if incomingReviewData.Rating == nil {
 		a.badRequestResponse(w, r, errors.New("rating is required"))
 		return
@@ -70,10 +62,12 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
-	// Create the review object based on the incoming data
+	// Create the review object based on the incoming data. The author
+	// is always the caller
+	userID := a.contextGetUser(r).ID
 	review := &data.Review{
 		BookID:     bookID,
-		UserID:     *incomingReviewData.UserID,
+		UserID:     userID,
 		Rating:     *incomingReviewData.Rating,
 		ReviewText: *incomingReviewData.ReviewText,
 		ReviewDate: time.Now(),
@@ -83,16 +77,21 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 	v := validator.New()
 
 	// Validate the review object
-	data.ValidateReview(v, review)
+	data.ValidateReview(v, review, a.contentPolicy.Load())
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// Insert the review into the database
-	err = a.reviewModel.InsertReview(review)
+	err = a.reviewModel.InsertReview(review, userID)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateReview):
+			a.duplicateReviewResponse(w, r, bookID)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -100,6 +99,7 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/api/v1/books/%d/reviews/%d", review.BookID, review.ReviewID))
 
+	review.RenderText(false)
 	data := envelope{
 		"review": review,
 	}
@@ -111,6 +111,13 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 }
 
 func (a *applicationDependencies) displayReviewHandler(w http.ResponseWriter, r *http.Request) {
+	// httprouter can't have /reviews/mine next to /reviews/:rid, so the
+	// caller's own review is picked out here
+	if httprouter.ParamsFromContext(r.Context()).ByName("rid") == "mine" {
+		a.displayMyReviewHandler(w, r)
+		return
+	}
+
 	// Get the "bid" (book ID) from the URL for potential use or validation
 	bid, err := a.readIDParam(r, "bid")
 	if err != nil {
@@ -136,8 +143,49 @@ func (a *applicationDependencies) displayReviewHandler(w http.ResponseWriter, r
 		return
 	}
 
-	// Call GetReview() to retrieve the review with the specified id
-	review, err := a.reviewModel.GetReview(rid)
+	review, ok := a.readVisibleReview(w, r, rid)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	hideSpoilers := a.getSingleBoolParameter(r.URL.Query(), "hide_spoilers", false, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	review.RenderText(hideSpoilers)
+
+	// Display the review
+	data := envelope{
+		"Review": review,
+	}
+	err = a.writeJSONWithETag(w, r, data, reviewETag(review, hideSpoilers))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// displayMyReviewHandler shows the caller's review of a book
+func (a *applicationDependencies) displayMyReviewHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "bid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	exists, err := a.bookModel.BookExists(bookID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.BIDnotFound(w, r, bookID)
+		return
+	}
+
+	review, err := a.reviewModel.GetUserBookReview(bookID, a.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -148,15 +196,99 @@ func (a *applicationDependencies) displayReviewHandler(w http.ResponseWriter, r
 		return
 	}
 
-	// Display the review
+	v := validator.New()
+	hideSpoilers := a.getSingleBoolParameter(r.URL.Query(), "hide_spoilers", false, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	review.RenderText(hideSpoilers)
+
 	data := envelope{
 		"Review": review,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSONWithETag(w, r, data, reviewETag(review, hideSpoilers))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// putMyReviewHandler creates the caller's review of a book, or replaces
+// it if they have one already
+func (a *applicationDependencies) putMyReviewHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "bid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Rating     int64  `json:"rating"`
+		ReviewText string `json:"review"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	exists, err := a.bookModel.BookExists(bookID)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	if !exists {
+		a.BIDnotFound(w, r, bookID)
+		return
+	}
+
+	userID := a.contextGetUser(r).ID
+	review := &data.Review{
+		BookID:     bookID,
+		UserID:     userID,
+		Rating:     incomingData.Rating,
+		ReviewText: strings.TrimSpace(incomingData.ReviewText),
+	}
+
+	v := validator.New()
+	data.ValidateReview(v, review, a.contentPolicy.Load())
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// the review being replaced, for If-Match and the revision history
+	before, err := a.reviewModel.GetUserBookReview(bookID, userID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if before != nil && !a.checkExpectedVersion(w, r, int64(before.Version)) {
+		return
+	}
+
+	created, err := a.reviewModel.UpsertReview(review, before)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", reviewETag(review, false))
+	status := http.StatusOK
+	if created {
+		headers.Set("Location", fmt.Sprintf("/api/v1/books/%d/reviews/%d", bookID, review.ReviewID))
+		status = http.StatusCreated
+	}
+
+	review.RenderText(false)
+	data := envelope{
+		"review": review,
+	}
+	err = a.writeJSON(w, status, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
 }
 
 func (a *applicationDependencies) bookReviewsHandler(w http.ResponseWriter, r *http.Request) {
@@ -178,18 +310,31 @@ func (a *applicationDependencies) bookReviewsHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	// Retrieve all reviews for the specified book
-	reviews, err := a.reviewModel.GetAllBookReviews(bookID)
+	v := validator.New()
+	filter, filters := a.readReviewListParameters(r.URL.Query(), v)
+	hideSpoilers := a.getSingleBoolParameter(r.URL.Query(), "hide_spoilers", false, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retrieve a page of the reviews for the specified book
+	reviews, metadata, err := a.reviewModel.GetAllBookReviews(bookID, filter, filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	a.signNextCursor(&metadata)
+	for _, review := range reviews {
+		review.RenderText(hideSpoilers)
+	}
 
 	// Return the reviews in JSON format
 	data := envelope{
-		"reviews": reviews,
+		"reviews":   reviews,
+		"@metadata": metadata,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeCollectionJSON(w, r, data)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -214,12 +359,16 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 		}
 		return
 	}
+	if !a.checkExpectedVersion(w, r, int64(review.Version)) {
+		return
+	}
+	before := *review
 
-	// // Define a struct to hold incoming JSON data
-	// var incomingReviewData struct {
-	// 	Rating     *int64  `json:"rating"`      // integer with a constraint (1-5)
-	// 	ReviewText *string `json:"review_text"` // non-null text field
-	// }
+	// Define a struct to hold incoming JSON data
+	var incomingReviewData struct {
+		Rating     *int64  `json:"rating"` // integer with a constraint (1-5)
+		ReviewText *string `json:"review"` // non-null text field
+	}
 
 	// Decode the incoming JSON into the struct
 	err = a.readJSON(w, r, &incomingReviewData)
@@ -237,24 +386,32 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 
 	// Validate the updated review
 	v := validator.New()
-	data.ValidateReview(v, review) // Assuming ValidateReview is the correct validation function for reviews
+	data.ValidateReview(v, review, a.contentPolicy.Load()) // Assuming ValidateReview is the correct validation function for reviews
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// Update the review in the database
-	err = a.reviewModel.UpdateReview(review)
+	err = a.reviewModel.UpdateReview(review, &before, a.contextGetUser(r).ID)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
 	// Send the updated review as a JSON response
+	review.RenderText(false)
 	data := envelope{
 		"review": review,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", reviewETag(review, false))
+	err = a.writeJSON(w, http.StatusOK, data, headers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -267,7 +424,21 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
-	err = a.reviewModel.DeleteReview(id)
+	review, err := a.reviewModel.GetReview(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.RIDnotFound(w, r, id) // Pass the ID to the custom message handler
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !a.checkExpectedVersion(w, r, int64(review.Version)) {
+		return
+	}
+
+	err = a.reviewModel.DeleteReview(review, a.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -286,3 +457,27 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+// readReviewListParameters reads the filters, sort and page of a review
+// listing and validates them. Reviews are sorted newest first by default
+func (a *applicationDependencies) readReviewListParameters(queryParameter url.Values, v *validator.Validator) (data.ReviewFilter, data.Filters) {
+	filter := data.ReviewFilter{
+		MinRating: int64(a.getSingleIntegerParameter(queryParameter, "min_rating", 1, v)),
+		MaxRating: int64(a.getSingleIntegerParameter(queryParameter, "max_rating", 5, v)),
+	}
+	if queryParameter.Has("has_text") {
+		hasText := a.getSingleBoolParameter(queryParameter, "has_text", false, v)
+		filter.HasText = &hasText
+	}
+
+	var filters data.Filters
+	filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 20, v)
+	filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "-date")
+	filters.SortSafeList = []string{"date", "rating", "helpful", "-date", "-rating", "-helpful"}
+	a.readCursorParameters(queryParameter, &filters, v)
+
+	data.ValidateReviewFilter(v, filter)
+	data.ValidateFilters(v, filters)
+	return filter, filters
+}
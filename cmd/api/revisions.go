@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+func (a *applicationDependencies) bookHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "bid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var queryParameterData struct {
+		data.Filters
+	}
+
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 20, v)
+	queryParameterData.Filters.Sort = "-id"
+	queryParameterData.Filters.SortSafeList = []string{"-id"}
+
+	data.ValidateFilters(v, queryParameterData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := a.revisionModel.GetAllForEntity(data.RevisionBook, id, queryParameterData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	data := envelope{
+		"history":   revisions,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertBookHandler puts the book's fields back to how they were in one
+// of its revisions. The revert is itself recorded, so it can be undone
+// by reverting to an earlier revision again
+func (a *applicationDependencies) revertBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "bid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		RevisionID int64 `json:"revision_id"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.RevisionID > 0, "revision_id", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revision, err := a.revisionModel.Get(incomingData.RevisionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("revision_id", "does not exist")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if revision.EntityType != data.RevisionBook || revision.EntityID != id {
+		v.AddError("revision_id", "is not a revision of this book")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var snapshot data.Book
+	err = json.Unmarshal(revision.Snapshot, &snapshot)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !a.checkExpectedVersion(w, r, int64(book.Version)) {
+		return
+	}
+	before := *book
+
+	book.Title = snapshot.Title
+	book.Authors = snapshot.Authors
+	book.ISBN = snapshot.ISBN
+	book.PublicationDate = snapshot.PublicationDate
+	book.Genre = snapshot.Genre
+	book.Description = snapshot.Description
+
+	err = a.bookModel.Revert(book, &before, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"Book": book,
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", bookETag(book))
+	err = a.writeJSON(w, http.StatusOK, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
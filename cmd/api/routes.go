@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/mtechguy/test3/internal/data"
 )
 
 func (a *applicationDependencies) routes() http.Handler {
@@ -21,9 +22,37 @@ func (a *applicationDependencies) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/api/v1/books/:bid", a.requireActivatedUser(a.displayBookHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/books", a.requireActivatedUser(a.listBooksHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/book/search", a.requireActivatedUser(a.searchBookHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/search/suggest", a.requireActivatedUser(a.suggestHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/book/export", a.requireActivatedUser(a.exportBooksHandler))
 	router.HandlerFunc(http.MethodPost, "/api/v1/books", a.requireActivatedUser(a.createBookHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/book/import", a.requireActivatedUser(a.importBooksHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/book/lookup", a.requireActivatedUser(a.lookupBookHandler))
 	router.HandlerFunc(http.MethodPatch, "/api/v1/books/:bid", a.requireActivatedUser(a.updateBookHandler))
 	router.HandlerFunc(http.MethodDelete, "/api/v1/books/:bid", a.requireActivatedUser(a.deleteBookHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/books/:bid/restore", a.requireActivatedUser(a.restoreBookHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/books/:bid/history", a.requireActivatedUser(a.bookHistoryHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/books/:bid/ratings", a.requireActivatedUser(a.bookRatingsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/books/duplicates", a.requirePermission(data.PermissionBooksAdmin, a.listDuplicateBooksHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/books/:bid/merge", a.requirePermission(data.PermissionBooksAdmin, a.mergeBooksHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/books/:bid/revert", a.requirePermission(data.PermissionBooksAdmin, a.revertBookHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/trash", a.requirePermission(data.PermissionBooksAdmin, a.listTrashHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/content-policy", a.requirePermission(data.PermissionBooksAdmin, a.displayContentPolicyHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/content-policy/reload", a.requirePermission(data.PermissionBooksAdmin, a.reloadContentPolicyHandler))
+
+	// Works Section
+	// =============
+	router.HandlerFunc(http.MethodGet, "/api/v1/works/:wid", a.requireActivatedUser(a.displayWorkHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/works/:wid/editions", a.requirePermission(data.PermissionBooksAdmin, a.attachEditionHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/admin/works/:wid/editions", a.requirePermission(data.PermissionBooksAdmin, a.detachEditionHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/works/:wid/merge", a.requirePermission(data.PermissionBooksAdmin, a.mergeWorksHandler))
+
+	// Series Section
+	// ==============
+	router.HandlerFunc(http.MethodPost, "/api/v1/series", a.requireActivatedUser(a.createSeriesHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/series/:sid", a.requireActivatedUser(a.displaySeriesHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/series/:sid/books", a.requireActivatedUser(a.addSeriesBookHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/series/:sid/books", a.requireActivatedUser(a.removeSeriesBookHandler))
 
 	// Reading Lists Section
 	// =====================
@@ -32,6 +61,7 @@ func (a *applicationDependencies) routes() http.Handler {
 	router.HandlerFunc(http.MethodPost, "/api/v1/lists", a.requireActivatedUser(a.createReadingListHandler))
 	router.HandlerFunc(http.MethodPatch, "/api/v1/lists/:lid", a.requireActivatedUser(a.updateReadingListHandler))
 	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:lid", a.requireActivatedUser(a.deleteReadingListHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:lid/restore", a.requireActivatedUser(a.restoreReadingListHandler))
 	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:lid/books", a.requireActivatedUser(a.addReadingListBookHandler))
 	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:lid/books", a.requireActivatedUser(a.RemoveReadingListBookHandler))
 
@@ -40,8 +70,27 @@ func (a *applicationDependencies) routes() http.Handler {
 	router.HandlerFunc(http.MethodPost, "/api/v1/books/:bid/reviews", a.requireActivatedUser(a.createReviewHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/books/:bid/reviews", a.requireActivatedUser(a.bookReviewsHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/books/:bid/reviews/:rid", a.requireActivatedUser(a.displayReviewHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/books/:bid/reviews/mine", a.requireActivatedUser(a.putMyReviewHandler))
 	router.HandlerFunc(http.MethodPatch, "/api/v1/reviews/:rid", a.requireActivatedUser(a.updateReviewHandler))
 	router.HandlerFunc(http.MethodDelete, "/api/v1/reviews/:rid", a.requireActivatedUser(a.deleteReviewHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/reviews/:rid/restore", a.requireActivatedUser(a.restoreReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/reviews/:rid/revisions", a.requireActivatedUser(a.listReviewRevisionsHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/reviews/:rid/votes", a.requireActivatedUser(a.voteReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/reviews/:rid/votes", a.requireActivatedUser(a.removeVoteHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/reviews/:rid/flags", a.requireActivatedUser(a.flagReviewHandler))
+
+	// Moderation Section
+	// ==================
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/moderation", a.requirePermission(data.PermissionReviewsModerate, a.moderationQueueHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/moderation/reviews/:rid", a.requirePermission(data.PermissionReviewsModerate, a.moderateReviewHandler))
+
+	// Comments Section
+	// ================
+	router.HandlerFunc(http.MethodGet, "/api/v1/reviews/:rid/comments", a.requireActivatedUser(a.listCommentsHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/reviews/:rid/comments", a.requireActivatedUser(a.createCommentHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/reviews/:rid/comments/:cid", a.requireActivatedUser(a.displayCommentHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/reviews/:rid/comments/:cid", a.requireActivatedUser(a.updateCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/reviews/:rid/comments/:cid", a.requireActivatedUser(a.deleteCommentHandler))
 
 	// Users Section
 	// =============
@@ -52,5 +101,10 @@ func (a *applicationDependencies) routes() http.Handler {
 	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/authentication", a.createAuthenticationTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/api/v1/users", a.registerUserHandler)
 
+	// Imports Section
+	// ===============
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/me/import/goodreads", a.requireActivatedUser(a.importGoodreadsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/imports/:jid", a.requireActivatedUser(a.displayImportJobHandler))
+
 	return a.recoverPanic(a.rateLimit(a.authenticate(router)))
 }
@@ -44,8 +44,9 @@ func (a *applicationDependencies) serve() error {
 		if err != nil {
 			shutdownError <- err
 		}
-		// Wait for background tasks to complete
+		// Stop the periodic jobs and wait for background tasks to complete
 		a.logger.Info("completing background tasks", "address", apiServer.Addr)
+		a.stopBackground()
 		a.wg.Wait()
 		shutdownError <- nil
 
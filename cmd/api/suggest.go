@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+func (a *applicationDependencies) suggestHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParameterData struct {
+		Prefix string
+		Kind   string
+		Limit  int
+	}
+
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	queryParameterData.Prefix = strings.TrimSpace(a.getSingleQueryParameter(queryParameter, "prefix", ""))
+	queryParameterData.Kind = a.getSingleQueryParameter(queryParameter, "kind", "")
+	queryParameterData.Limit = a.getSingleIntegerParameter(queryParameter, "limit", 10, v)
+
+	v.Check(queryParameterData.Prefix != "", "prefix", "must be provided")
+	v.Check(len(queryParameterData.Prefix) <= 100, "prefix", "must not be more than 100 bytes long")
+	if queryParameterData.Kind != "" {
+		v.Check(validator.PermittedValue(queryParameterData.Kind, data.SuggestionKinds...), "kind", "must be one of 'title', 'author' or 'genre'")
+	}
+	v.Check(queryParameterData.Limit > 0 && queryParameterData.Limit <= 25, "limit", "must be between 1 and 25")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := a.suggestionModel.Get(queryParameterData.Prefix, queryParameterData.Kind, queryParameterData.Limit)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"suggestions": suggestions,
+	}
+	err = a.writeCollectionJSON(w, r, data)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshSuggestions periodically rebuilds the search suggestions so they
+// follow new books, reviews and reading lists. An interval of zero turns
+// the refresh off
+func (a *applicationDependencies) refreshSuggestions() {
+	if a.config.search.suggestRefresh <= 0 {
+		return
+	}
+
+	a.backgroundEvery(a.config.search.suggestRefresh, func() {
+		err := a.suggestionModel.Refresh()
+		if err != nil {
+			a.logger.Error("refreshing search suggestions failed", "error", err.Error())
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// checkCanRestore checks the user may take an item out of the trash,
+// which its owner and admins can, and moderators for reviews. Books have
+// no owner, and neither does a review a moderator deleted, so only admins
+// and moderators can restore those. It writes the error response itself
+// and returns false if the user can't
+func (a *applicationDependencies) checkCanRestore(w http.ResponseWriter, r *http.Request, itemType string, id int64) bool {
+	owner, err := a.trashModel.Owner(itemType, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	user := a.contextGetUser(r)
+	if owner != 0 && owner == user.ID {
+		return true
+	}
+
+	permissions, err := a.permissionModel.GetAllForUser(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return false
+	}
+	if permissions.Include(data.PermissionBooksAdmin) {
+		return true
+	}
+	if itemType == "review" && permissions.Include(data.PermissionReviewsModerate) {
+		return true
+	}
+	a.notPermittedResponse(w, r)
+	return false
+}
+
+func (a *applicationDependencies) restoreBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "bid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+	if !a.checkCanRestore(w, r, "book", id) {
+		return
+	}
+
+	book, err := a.bookModel.Restore(id, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "Book successfully restored",
+		"Book":    book,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) restoreReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "lid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+	if !a.checkCanRestore(w, r, "list", id) {
+		return
+	}
+
+	list, err := a.readingListModel.Restore(id, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message":      "Reading List successfully restored",
+		"Reading List": list,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) restoreReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "rid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+	if !a.checkCanRestore(w, r, "review", id) {
+		return
+	}
+
+	review, err := a.reviewModel.RestoreReview(id, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateReview):
+			v := validator.New()
+			v.AddError("review", "the user has reviewed this book again since it was deleted")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "Review successfully restored",
+		"Review":  review,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParameterData struct {
+		Type string
+		data.Filters
+	}
+
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	queryParameterData.Type = a.getSingleQueryParameter(queryParameter, "type", "")
+	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 20, v)
+	queryParameterData.Filters.Sort = "-deleted_at"
+	queryParameterData.Filters.SortSafeList = []string{"-deleted_at"}
+
+	if queryParameterData.Type != "" {
+		v.Check(validator.PermittedValue(queryParameterData.Type, data.TrashTypes...), "type", "must be one of 'book', 'list' or 'review'")
+	}
+	data.ValidateFilters(v, queryParameterData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items, metadata, err := a.trashModel.GetAll(queryParameterData.Type, queryParameterData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"trash":     items,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash periodically removes for good whatever has been in the
+// trash for longer than the configured retention period. A purge
+// interval of zero turns the purge off
+func (a *applicationDependencies) purgeTrash() {
+	if a.config.trash.purgeInterval <= 0 {
+		return
+	}
+
+	a.backgroundEvery(a.config.trash.purgeInterval, func() {
+		result, err := a.trashModel.Purge(a.config.trash.retention)
+		if err != nil {
+			a.logger.Error("purging trash failed", "error", err.Error())
+			return
+		}
+		if result.Books+result.Lists+result.Reviews > 0 {
+			a.logger.Info("purged trash", "books", result.Books,
+				"lists", result.Lists, "reviews", result.Reviews)
+		}
+	})
+}
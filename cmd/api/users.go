@@ -185,20 +185,32 @@ func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r
 		return
 	}
 
-	// Get the reviews for the user
-	reviews, err := a.userModel.GetUserReviews(id)
+	v := validator.New()
+	filter, filters := a.readReviewListParameters(r.URL.Query(), v)
+	hideSpoilers := a.getSingleBoolParameter(r.URL.Query(), "hide_spoilers", false, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Get a page of the reviews for the user
+	reviews, metadata, err := a.userModel.GetUserReviews(id, filter, filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	a.signNextCursor(&metadata)
+	for i := range reviews {
+		reviews[i].RenderText(hideSpoilers)
+	}
 
 	// Display the user information along with their reviews
 	data := envelope{
-
 		"User Reviews": reviews,
+		"@metadata":    metadata,
 	}
 
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeCollectionJSON(w, r, data)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -227,7 +239,7 @@ func (a *applicationDependencies) getUserListsHandler(w http.ResponseWriter, r *
 		"User Lists": lists,
 	}
 
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeCollectionJSON(w, r, data)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// voteReviewHandler records the caller's up or down vote on a review.
+// Voting again replaces the earlier vote
+func (a *applicationDependencies) voteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "rid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Vote string `json:"vote"` // "up" or "down"
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	review, ok := a.readVisibleReview(w, r, id)
+	if !ok {
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(incomingData.Vote, "up", "down"), "vote", "must be up or down")
+	v.Check(review.UserID != user.ID, "vote", "you can't vote on your own review")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	vote := data.VoteHelpful
+	if incomingData.Vote == "down" {
+		vote = data.VoteUnhelpful
+	}
+
+	err = a.reviewModel.Vote(id, user.ID, vote)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.writeVoteTally(w, r, id)
+}
+
+// removeVoteHandler takes the caller's vote on a review back
+func (a *applicationDependencies) removeVoteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "rid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.reviewModel.RemoveVote(id, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.writeVoteTally(w, r, id)
+}
+
+// writeVoteTally sends back how a review stands after a vote
+func (a *applicationDependencies) writeVoteTally(w http.ResponseWriter, r *http.Request, reviewID int64) {
+	tally, err := a.reviewModel.GetVotes(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.RIDnotFound(w, r, reviewID)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"votes": tally,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mtechguy/test3/internal/data"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+func (a *applicationDependencies) displayWorkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	hideSpoilers := a.getSingleBoolParameter(r.URL.Query(), "hide_spoilers", false, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	work, err := a.workModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	editions, err := a.workModel.GetEditions(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	reviews, err := a.workModel.GetReviews(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, review := range reviews {
+		review.RenderText(hideSpoilers)
+	}
+
+	data := envelope{
+		"work":     work,
+		"editions": editions,
+		"reviews":  reviews,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) attachEditionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		BookID int64 `json:"book_id"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.BookID > 0, "book_id", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.workModel.AttachEdition(id, incomingData.BookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.writeWork(w, r, id)
+}
+
+func (a *applicationDependencies) detachEditionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		BookID int64 `json:"book_id"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.BookID > 0, "book_id", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	work, err := a.workModel.DetachEdition(id, incomingData.BookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "Edition successfully detached",
+		"work":    work,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) mergeWorksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		WorkID int64 `json:"work_id"` // the work that is merged into :wid
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.WorkID > 0, "work_id", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.workModel.Merge(id, incomingData.WorkID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrSameWork):
+			v.AddError("work_id", err.Error())
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.writeWork(w, r, id)
+}
+
+// writeWork sends back a work with its editions after an admin change
+func (a *applicationDependencies) writeWork(w http.ResponseWriter, r *http.Request, id int64) {
+	work, err := a.workModel.Get(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	editions, err := a.workModel.GetEditions(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"work":     work,
+		"editions": editions,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,182 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A single row coming from an import file. Row is the 1-based line
+// number of the record in the file (not counting the CSV header) so the
+// client can match the report back to its data
+type BookImportRow struct {
+	Row  int
+	Book *Book
+}
+
+// The outcome of one row of an import
+type BookImportResult struct {
+	Row    int               `json:"row"`
+	ID     int64             `json:"id,omitempty"`
+	ISBN   string            `json:"isbn,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// The report returned to the client once an import finishes
+type BookImportReport struct {
+	DryRun  bool               `json:"dry_run"`
+	Created []BookImportResult `json:"created"`
+	Skipped []BookImportResult `json:"skipped"`
+	Failed  []BookImportResult `json:"failed"`
+}
+
+func NewBookImportReport(dryRun bool) *BookImportReport {
+	return &BookImportReport{
+		DryRun:  dryRun,
+		Created: []BookImportResult{},
+		Skipped: []BookImportResult{},
+		Failed:  []BookImportResult{},
+	}
+}
+
+// NormalizeISBN strips the hyphens and spaces that are commonly used
+// when printing an ISBN so that "978-0-13-468599-1" and "9780134685991"
+// are treated as the same book
+func NormalizeISBN(isbn string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(isbn))
+}
+
+// Import inserts the already validated rows inside a single transaction,
+// along with a revision for each book actorID added. Rows whose ISBN is
+// already in the catalog (or appeared earlier in the same file) are
+// skipped. When dryRun is true nothing is written, but the report still
+// shows what would have happened
+func (c BookModel) Import(rows []BookImportRow, report *BookImportReport, actorID int64) error {
+	// an import can be a few thousand rows so we give it more time
+	// than the usual 3 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	isbns := make([]string, 0, len(rows))
+	for _, row := range rows {
+		isbns = append(isbns, row.Book.ISBN)
+	}
+
+	// the catalog can hold ISBNs with hyphens or spaces in them, so both
+	// sides are compared normalised
+	existing := make(map[string]bool)
+	dbRows, err := tx.QueryContext(ctx, `
+	SELECT normalize_isbn(isbn) FROM books
+	WHERE normalize_isbn(isbn) = ANY($1) AND deleted_at IS NULL`, pq.Array(isbns))
+	if err != nil {
+		return err
+	}
+	defer dbRows.Close()
+
+	for dbRows.Next() {
+		var isbn string
+		err := dbRows.Scan(&isbn)
+		if err != nil {
+			return err
+		}
+		existing[isbn] = true
+	}
+	err = dbRows.Err()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]int)
+	query := `
+	INSERT INTO books (title, authors, isbn, publication_date, genre, description, language)
+	VALUES ($1, $2, $3, $4, $5, $6, COALESCE(NULLIF($7, '')::regconfig, $8::regconfig))
+	RETURNING id, language, work_id, version
+	`
+
+	for _, row := range rows {
+		book := row.Book
+		if existing[book.ISBN] {
+			report.Skipped = append(report.Skipped, BookImportResult{
+				Row: row.Row, ISBN: book.ISBN, Reason: "a book with this isbn already exists",
+			})
+			continue
+		}
+		if first, found := seen[book.ISBN]; found {
+			report.Skipped = append(report.Skipped, BookImportResult{
+				Row: row.Row, ISBN: book.ISBN, Reason: fmt.Sprintf("duplicate of row %d", first),
+			})
+			continue
+		}
+		seen[book.ISBN] = row.Row
+
+		result := BookImportResult{Row: row.Row, ISBN: book.ISBN}
+		if !report.DryRun {
+			args := []any{book.Title, book.Authors, book.ISBN, book.PublicationDate, book.Genre, book.Description, book.Language, defaultSearchLanguage}
+			err = tx.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.Language, &book.WorkID, &book.Version)
+			if err != nil {
+				return err
+			}
+			err = insertRevision(ctx, tx, RevisionBook, book.ID, RevisionInsert, actorID, nil, book)
+			if err != nil {
+				return err
+			}
+			result.ID = book.ID
+		}
+		report.Created = append(report.Created, result)
+	}
+
+	if report.DryRun {
+		return nil
+	}
+
+	return tx.Commit()
+}
+
+// ISBN13 returns the 13 digit form of an ISBN. Older books often only
+// have the 10 digit form, which is converted by adding the 978 prefix
+// and recomputing the check digit. Anything else comes back empty
+func ISBN13(isbn string) string {
+	isbn = strings.ToUpper(NormalizeISBN(isbn))
+	switch len(isbn) {
+	case 13:
+		for _, r := range isbn {
+			if r < '0' || r > '9' {
+				return ""
+			}
+		}
+		return isbn
+	case 10:
+		for i, r := range isbn {
+			if (r < '0' || r > '9') && !(r == 'X' && i == 9) {
+				return ""
+			}
+		}
+		digits := "978" + isbn[:9]
+		sum := 0
+		for i, r := range digits {
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += int(r-'0') * weight
+		}
+		return fmt.Sprintf("%s%d", digits, (10-sum%10)%10)
+	}
+	return ""
+}
@@ -6,10 +6,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"html"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/mtechguy/test3/internal/policy"
 	"github.com/mtechguy/test3/internal/validator"
 )
 
@@ -24,9 +26,18 @@ type Book struct {
 	Genre           string  `json:"genre"`            // Optional field, use a pointer to handle NULL
 	Description     string  `json:"description"`      // Optional field, use a pointer to handle NULL
 	AverageRating   float32 `json:"average_rating"`   // DECIMAL maps to float64
+	Language        string  `json:"language"`         // text search configuration used for the book
+	WorkID          int64   `json:"work_id"`          // the work this book is an edition of
 	Version         int32   `json:"version"`          // Default field for versioning
 }
 
+// The PostgreSQL text search configurations a book's language can be set
+// to. "simple" does no stemming at all and suits any language
+var SearchLanguages = []string{"simple", "danish", "dutch", "english", "finnish", "french", "german",
+	"hungarian", "italian", "norwegian", "portuguese", "romanian", "russian", "spanish", "swedish", "turkish"}
+
+const defaultSearchLanguage = "english"
+
 type BookModel struct {
 	DB *sql.DB
 }
@@ -34,7 +45,7 @@ type BookModel struct {
 // Example Exists method in bookModel
 func (m *BookModel) Exists(bookID int) (bool, error) {
 	var exists bool
-	query := "SELECT EXISTS (SELECT 1 FROM books WHERE id = $1)"
+	query := "SELECT EXISTS (SELECT 1 FROM books WHERE id = $1 AND deleted_at IS NULL)"
 	err := m.DB.QueryRow(query, bookID).Scan(&exists)
 	if err != nil {
 		return false, err
@@ -42,7 +53,19 @@ func (m *BookModel) Exists(bookID int) (bool, error) {
 	return exists, nil
 }
 
-func ValidateBook(v *validator.Validator, book *Book) {
+func ValidateBook(v *validator.Validator, book *Book, contentPolicy *policy.Policy) {
+	// Check if the publication date, genre and description are provided
+	v.Check(strings.TrimSpace(book.PublicationDate) != "", "publication_date", "must be provided")
+	v.Check(strings.TrimSpace(book.Genre) != "", "genre", "must be provided")
+	v.Check(strings.TrimSpace(book.Description) != "", "description", "must be provided")
+
+	ValidateImportedBook(v, book, contentPolicy)
+}
+
+// ValidateImportedBook checks a book added by an import, which only
+// brings a title, authors and an ISBN. The other fields are checked when
+// they are set
+func ValidateImportedBook(v *validator.Validator, book *Book, contentPolicy *policy.Policy) {
 	// Validate the Title field
 	v.Check(strings.TrimSpace(book.Title) != "", "title", "must be provided")
 	v.Check(len(book.Title) <= 200, "title", "must not be more than 200 bytes long")
@@ -55,72 +78,98 @@ func ValidateBook(v *validator.Validator, book *Book) {
 	v.Check(len(book.ISBN) == 13, "isbn", "must be 13 digits long")
 	v.Check(regexp.MustCompile(`^\d{13}$`).MatchString(book.ISBN), "isbn", "must contain only digits")
 
-	// Check if the publication date is provided
-	v.Check(strings.TrimSpace(book.PublicationDate) != "", "publication_date", "must be provided")
-
-	// Regular expression to match the format "July 12, 2024"
-	dateRegex := `^[A-Za-z]+ \d{1,2}, \d{4}$`
-	re := regexp.MustCompile(dateRegex)
+	if book.PublicationDate != "" {
+		// Regular expression to match the format "July 12, 2024"
+		dateRegex := `^[A-Za-z]+ \d{1,2}, \d{4}$`
+		re := regexp.MustCompile(dateRegex)
 
-	// Check if the date matches the regex
-	if !re.MatchString(book.PublicationDate) {
-		v.AddError("publication_date", "must be in the format 'July 12, 2020'")
+		// Check if the date matches the regex
+		if !re.MatchString(book.PublicationDate) {
+			v.AddError("publication_date", "must be in the format 'July 12, 2020'")
+		}
 	}
 
 	// Check if the length of the publication date is less than or equal to 200
 	v.Check(len(book.PublicationDate) <= 200, "publication_date", "must not be more than 200 bytes long")
 
-	v.Check(strings.TrimSpace(book.Genre) != "", "genre", "must be provided")
 	v.Check(len(book.Genre) <= 200, "genre", "must not be more than 200 bytes long")
 
 	// Validate the Description field
-	v.Check(strings.TrimSpace(book.Description) != "", "description", "must be provided")
 	v.Check(len(book.Description) <= 200, "description", "must not be more than 200 bytes long")
+	contentPolicy.Check(v, "description", book.Description)
 
+	// an empty language falls back to the default when the book is saved
+	if book.Language != "" {
+		v.Check(validator.PermittedValue(book.Language, SearchLanguages...), "language", "must be a supported search language")
+	}
 }
 
-func (c BookModel) Insert(book *Book) error {
+// Insert adds the book and records the insert in the revision history
+// in the same transaction. actorID is the user adding it
+func (c BookModel) Insert(book *Book, actorID int64) error {
 	// the SQL query to be executed against the database table
 	query := `
-	INSERT INTO books (title, authors, isbn, publication_date, genre, description) 
-	VALUES ($1, $2, $3, $4, $5, $6) 
-	RETURNING id, version;
+	INSERT INTO books (title, authors, isbn, publication_date, genre, description, language) 
+	VALUES ($1, $2, $3, $4, $5, $6, COALESCE(NULLIF($7, '')::regconfig, $8::regconfig)) 
+	RETURNING id, language, work_id, version;
 		 `
 	// the actual values to replace $1, and $2
-	args := []any{book.Title, book.Authors, book.ISBN, book.PublicationDate, book.Genre, book.Description}
+	args := []any{book.Title, book.Authors, book.ISBN, book.PublicationDate, book.Genre, book.Description, book.Language, defaultSearchLanguage}
 
 	// Create a context with a 3-second timeout. No database
 	// operation should take more than 3 seconds or we will quit it
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// execute the query against the comments database table. We ask for the the
 	// id, created_at, and version to be sent back to us which we will use
 	// to update the Comment struct later on
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
 		&book.ID,
+		&book.Language,
+		&book.WorkID,
 		&book.Version)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(ctx, tx, RevisionBook, book.ID, RevisionInsert, actorID, nil, book)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Get a specific Comment from the comments table
 func (c BookModel) Get(id int64) (*Book, error) {
+	// Set a 3-second context/timer
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getBook(ctx, c.DB, id)
+}
+
+// getBook reads a book with q, which is the database or a transaction
+func getBook(ctx context.Context, q rowQuerier, id int64) (*Book, error) {
 	// check if the id is valid
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	// the SQL query to be executed against the database table
 	query := `
-		 SELECT  id, title, authors, isbn, publication_date, genre, description, average_rating, version
+		 SELECT  id, title, authors, isbn, publication_date, genre, description, average_rating, language, work_id, version
 		 FROM books
-		 WHERE id = $1
+		 WHERE id = $1 AND deleted_at IS NULL
 	   `
 	// declare a variable of type Comment to store the returned comment
 	var book Book
 
-	// Set a 3-second context/timer
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := c.DB.QueryRowContext(ctx, query, id).Scan(
+	err := q.QueryRowContext(ctx, query, id).Scan(
 		&book.ID,
 		&book.Title,
 		&book.Authors, // pq.Array handles TEXT[] types
@@ -129,6 +178,8 @@ func (c BookModel) Get(id int64) (*Book, error) {
 		&book.Genre,
 		&book.Description,
 		&book.AverageRating,
+		&book.Language,
+		&book.WorkID,
 		&book.Version,
 	)
 	// Cont'd on the next slide
@@ -144,42 +195,82 @@ func (c BookModel) Get(id int64) (*Book, error) {
 	return &book, nil
 }
 
-func (c BookModel) Update(book *Book) error {
+// Update saves the changes to the book and records them in the revision
+// history in the same transaction. before is the book as it was read
+func (c BookModel) Update(book *Book, before *Book, actorID int64) error {
+	return c.update(book, before, actorID, RevisionUpdate)
+}
+
+// Revert is Update for a book put back to one of its earlier revisions
+func (c BookModel) Revert(book *Book, before *Book, actorID int64) error {
+	return c.update(book, before, actorID, RevisionRevert)
+}
+
+func (c BookModel) update(book *Book, before *Book, actorID int64, action string) error {
 	// The SQL query to be executed against the database table
 	// Every time we make an update, we increment the version number
 	query := `
 			UPDATE books
-			SET  title = $1, authors = $2, isbn = $3, publication_date = $4, genre = $5, description = $6, version = version + 1
-			WHERE id = $7
-			RETURNING version 
+			SET  title = $1, authors = $2, isbn = $3, publication_date = $4, genre = $5, description = $6,
+			     language = COALESCE(NULLIF($9, '')::regconfig, language), version = version + 1
+			WHERE id = $7 AND version = $8 AND deleted_at IS NULL
+			RETURNING language, version 
 			`
 
-	args := []any{book.Title, book.Authors, book.ISBN, book.PublicationDate, book.Genre, book.Description, book.ID}
+	args := []any{book.Title, book.Authors, book.ISBN, book.PublicationDate, book.Genre, book.Description, book.ID, book.Version, book.Language}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// no row means the book was changed (or deleted) since it was read
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&book.Language, &book.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
 
+	err = insertRevision(ctx, tx, RevisionBook, book.ID, action, actorID, before, book)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (c BookModel) Delete(id int64) error {
+// Delete moves the book to the trash and records that in the revision
+// history in the same transaction. book is the book as it was read
+func (c BookModel) Delete(book *Book, actorID int64) error {
 
 	// check if the id is valid
-	if id < 1 {
+	if book.ID < 1 {
 		return ErrRecordNotFound
 	}
-	// the SQL query to be executed against the database table
+	// the book is only marked as deleted so that its reviews and list
+	// entries survive until the trash is purged
 	query := `
-        DELETE FROM books
-        WHERE id = $1
+        UPDATE books
+        SET deleted_at = NOW(), version = version + 1
+        WHERE id = $1 AND deleted_at IS NULL
 		`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// ExecContext does not return any rows unlike QueryRowContext.
 	// It only returns  information about the the query execution
 	// such as how many rows were affected
-	result, err := c.DB.ExecContext(ctx, query, id)
+	result, err := tx.ExecContext(ctx, query, book.ID)
 	if err != nil {
 		return err
 	}
@@ -194,24 +285,95 @@ func (c BookModel) Delete(id int64) error {
 		return ErrRecordNotFound
 	}
 
-	return nil
+	err = insertRevision(ctx, tx, RevisionBook, book.ID, RevisionDelete, actorID, book, nil)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Restore takes a book back out of the trash and records that in the
+// revision history in the same transaction. It returns the book as it
+// is now
+func (c BookModel) Restore(id int64, actorID int64) (*Book, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+        UPDATE books
+        SET deleted_at = NULL, version = version + 1
+        WHERE id = $1 AND deleted_at IS NOT NULL
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
 
+	book, err := getBook(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = insertRevision(ctx, tx, RevisionBook, id, RevisionRestore, actorID, nil, book)
+	if err != nil {
+		return nil, err
+	}
+	return book, tx.Commit()
 }
 
-func (c BookModel) GetAll(filters Filters) ([]*Book, Metadata, error) {
+func (c BookModel) GetAll(filter BookFilter, filters Filters) ([]*Book, Metadata, error) {
 
-	// the SQL query to be executed against the database table
-	query := fmt.Sprintf(`
-	SELECT COUNT(*) OVER(), id, title, authors, isbn, publication_date, genre, description, average_rating , version
-	FROM books
-	ORDER BY %s %s, id ASC
-	LIMIT $1 OFFSET $2
-	`, filters.sortColumn(), filters.sortDirection())
+	args := []any{}
+	conditions := append([]string{"b.deleted_at IS NULL"}, filter.conditions(&args)...)
+	where := strings.Join(conditions, "\n\tAND ")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	totalRecords, err := countRecords(ctx, c.DB, filters, `SELECT COUNT(*) FROM books b WHERE `+where, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	keys := filters.sortKeys()
+	keyset := keysetCondition(keys, filters.Cursor, &args)
+	args = append(args, filters.fetch(), filters.offset())
+
+	// the weighted rating needs the average of the whole catalog, so it
+	// is only worked out when the books are sorted by it
+	source, score := "books b", "0"
+	if filters.sortColumn() == "weighted_rating" {
+		source = fmt.Sprintf(`(SELECT b.*, %s AS weighted_rating FROM books b, %s) b`, weightedRating, bookRatingPrior)
+		score = "weighted_rating"
+	}
+
+	// the SQL query to be executed against the database table
+	query := fmt.Sprintf(`
+	SELECT id, title, authors, isbn, publication_date, genre, description, average_rating, language, work_id, version, %s
+	FROM %s
+	WHERE %s
+	AND %s
+	ORDER BY %s
+	LIMIT $%d OFFSET $%d
+	`, score, source, where, keyset, orderBy(keys), len(args)-1, len(args))
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
 
 	if err != nil {
 		return nil, Metadata{}, err
@@ -219,15 +381,16 @@ func (c BookModel) GetAll(filters Filters) ([]*Book, Metadata, error) {
 
 	// clean up the memory that was used
 	defer rows.Close()
-	totalRecords := 0
 	// we will store the address of each comment in our slice
 	books := []*Book{}
+	scores := make(map[int64]float64)
 
 	// process each row that is in rows
 
 	for rows.Next() {
 		var book Book
-		err := rows.Scan(&totalRecords,
+		var score float64
+		err := rows.Scan(
 			&book.ID,
 			&book.Title,
 			&book.Authors,
@@ -236,13 +399,17 @@ func (c BookModel) GetAll(filters Filters) ([]*Book, Metadata, error) {
 			&book.Genre,
 			&book.Description,
 			&book.AverageRating,
+			&book.Language,
+			&book.WorkID,
 			&book.Version,
+			&score,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 		// add the row to our slice
 		books = append(books, &book)
+		scores[book.ID] = score
 	} // end of for loop
 
 	// after we exit the loop we need to check if it generated any errors
@@ -251,47 +418,257 @@ func (c BookModel) GetAll(filters Filters) ([]*Book, Metadata, error) {
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	books, next := nextCursor(books, filters, func(book *Book) []any {
+		values := book.sortValues(keys)
+		if keys[0].Column == "weighted_rating" {
+			values[0] = scores[book.ID]
+		}
+		return values
+	})
+	metadata := pageMetadata(filters, totalRecords, next)
 
 	return books, metadata, nil
 
 }
 
-func (c BookModel) Search(title string, author string, genre string, filters Filters) ([]*Book, Metadata, error) {
+// sortValues returns the book's values for the sort keys, which is what
+// a cursor pointing at it holds
+func (b *Book) sortValues(keys []sortKey) []any {
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		switch key.Column {
+		case "id":
+			values[i] = b.ID
+		case "title":
+			values[i] = b.Title
+		case "authors":
+			values[i] = b.Authors
+		case "genre":
+			values[i] = b.Genre
+		}
+	}
+	return values
+}
 
-	// the SQL query to be executed against the database table
-	query := fmt.Sprintf(`
-	SELECT COUNT(*) OVER(), id, title, authors, isbn, publication_date, genre, description, average_rating, version
-	FROM books
-	WHERE (to_tsvector('simple', title) @@
-		  plainto_tsquery('simple', $1) OR $1 = '') 
-	AND (to_tsvector('simple', authors) @@ 
-		 plainto_tsquery('simple', $2) OR $2 = '')
-	AND (to_tsvector('simple', genre) @@ 
-		 plainto_tsquery('simple', $3) OR $3 = '') 
-	ORDER BY %s %s, id ASC 
-	LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+// A book found by Search. Rank is the full-text score, Similarity how
+// close the title or authors are to the query for near misses, and
+// Headline an excerpt of the description with the matches in <b> tags.
+// The headline is escaped HTML, the <b> tags are the only markup in it
+type BookSearchResult struct {
+	*Book
+	Rank       float64 `json:"rank"`
+	Similarity float64 `json:"similarity"`
+	Headline   string  `json:"headline,omitempty"`
+}
+
+// ts_headline marks the matches with these, which can't be in the
+// description it is given. The description is raw text, so the headline
+// is escaped before the markers become <b> tags
+const (
+	headlineStart = "\x02"
+	headlineStop  = "\x03"
+)
+
+var headlineTags = strings.NewReplacer(headlineStart, "<b>", headlineStop, "</b>")
+
+func escapeHeadline(headline string) string {
+	return headlineTags.Replace(html.EscapeString(headline))
+}
+
+// bookSearchCondition matches books against the query $1 parsed with the
+// language $2. The query is also parsed with "simple" so author names
+// are not stemmed, and a trigram match on the title or authors catches
+// misspellings that full-text search misses. An empty query matches
+// every book
+const bookSearchCondition = `
+	b.deleted_at IS NULL
+	AND ($1 = '' OR b.search_vector @@ q.tsq
+		OR lower(b.title) % lower($1) OR lower(b.authors) % lower($1))`
+
+const bookSearchQuery = `(SELECT websearch_to_tsquery($2::regconfig, $1) || websearch_to_tsquery('simple', $1) AS tsq) q`
+
+// searchKeys are the sort keys of a search. "relevance" puts full-text
+// matches first, best ranked first, and then the closest near misses
+func searchKeys(filters Filters) []sortKey {
+	if filters.sortColumn() == "relevance" {
+		return []sortKey{{Column: "rank", Desc: true}, {Column: "similarity", Desc: true}, {Column: "id"}}
+	}
+	return filters.sortKeys()
+}
+
+// Search runs a single query over the title, authors, genre and
+// description of every book, narrowed down by the facet values picked.
+// The criteria's language is the text search configuration the query is
+// parsed with. The counts for the requested facets come back from the
+// same statement as the page
+func (c BookModel) Search(criteria BookSearchCriteria, facets []string, filters Filters) ([]*BookSearchResult, map[string][]FacetCount, Metadata, error) {
+
+	args := []any{criteria.Query, criteria.Language}
+	where := criteria.where(&args)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query, title, author, genre, filters.limit(), filters.offset())
+	totalRecords, err := countRecords(ctx, c.DB, filters,
+		fmt.Sprintf(`SELECT COUNT(*) FROM books b, %s WHERE %s`, bookSearchQuery, where), args...)
+	if err != nil {
+		return nil, nil, Metadata{}, err
+	}
+
+	// matched leaves the facet selections out so the facet counts can
+	// each ignore their own, and the page applies all of them
+	args = []any{criteria.Query, criteria.Language}
+	columns := criteria.facetColumns(&args)
+	conditions := append([]string{bookSearchCondition}, criteria.BookFilter.conditions(&args)...)
+	picked := []string{}
+	for _, facet := range BookFacetNames {
+		picked = append(picked, facet+"_ok")
+	}
+
+	keys := searchKeys(filters)
+	keyset := keysetCondition(keys, filters.Cursor, &args)
+	args = append(args, filters.fetch(), filters.offset())
+
+	// the headline is the expensive part, so it is only worked out for
+	// the books on the requested page. The facet counts are joined onto
+	// the page, which leaves a single row of NULLs when it is empty
+	sqlQuery := fmt.Sprintf(`
+	WITH matched AS (
+		SELECT b.id, b.title, b.authors, b.isbn, b.publication_date, b.genre,
+		       b.description, b.average_rating, b.language, b.work_id, b.version, q.tsq,
+		       ts_rank(b.search_vector, q.tsq) AS rank,
+		       GREATEST(similarity(lower(b.title), lower($1)), similarity(lower(COALESCE(b.authors, '')), lower($1))) AS similarity,
+		       %s
+		FROM books b, %s
+		WHERE %s
+	),
+	page AS (
+		SELECT id, title, authors, isbn, publication_date, genre, description, average_rating, language, work_id, version,
+		       rank, similarity,
+		       CASE WHEN $1 = '' THEN '' ELSE ts_headline(language, translate(COALESCE(description, ''), chr(2) || chr(3), ''), tsq,
+		       	'MaxFragments=2, MinWords=5, MaxWords=20, StartSel=' || chr(2) || ', StopSel=' || chr(3)) END AS headline
+		FROM (
+			SELECT *
+			FROM matched
+			WHERE %s
+			AND %s
+			ORDER BY %s
+			LIMIT $%d OFFSET $%d
+		) matches
+	),
+	facet_counts AS (
+		%s
+	)
+	SELECT COALESCE(id, 0), COALESCE(title, ''), COALESCE(authors, ''), COALESCE(isbn, ''),
+	       COALESCE(publication_date, ''), COALESCE(genre, ''), COALESCE(description, ''),
+	       COALESCE(average_rating, 0), COALESCE(language, ''), COALESCE(work_id, 0), COALESCE(version, 0),
+	       COALESCE(rank, 0), COALESCE(similarity, 0), COALESCE(headline, ''), facet_counts.counts
+	FROM facet_counts
+	LEFT JOIN page ON true
+	ORDER BY %s`,
+		strings.Join(columns, ",\n\t\t       "), bookSearchQuery, strings.Join(conditions, "\n\t\tAND "),
+		strings.Join(picked, " AND "), keyset, orderBy(keys), len(args)-1, len(args),
+		facetCounts(facets), orderBy(keys))
+
+	rows, err := c.DB.QueryContext(ctx, sqlQuery, args...)
 
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, nil, Metadata{}, err
 	}
 
 	// clean up the memory that was used
 	defer rows.Close()
-	totalRecords := 0
-	// we will store the address of each comment in our slice
-	books := []*Book{}
+	results := []*BookSearchResult{}
+	var counts []byte
 
-	// process each row that is in rows
+	for rows.Next() {
+		result := BookSearchResult{Book: &Book{}}
+		err := rows.Scan(
+			&result.ID,
+			&result.Title,
+			&result.Authors,
+			&result.ISBN,
+			&result.PublicationDate,
+			&result.Genre,
+			&result.Description,
+			&result.AverageRating,
+			&result.Language,
+			&result.WorkID,
+			&result.Version,
+			&result.Rank,
+			&result.Similarity,
+			&result.Headline,
+			&counts,
+		)
+		if err != nil {
+			return nil, nil, Metadata{}, err
+		}
+		if result.ID == 0 {
+			continue
+		}
+		result.Headline = escapeHeadline(result.Headline)
+		results = append(results, &result)
+	}
+
+	// after we exit the loop we need to check if it generated any errors
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, Metadata{}, err
+	}
+
+	counted, err := decodeFacetCounts(facets, counts)
+	if err != nil {
+		return nil, nil, Metadata{}, err
+	}
+
+	results, next := nextCursor(results, filters, func(result *BookSearchResult) []any {
+		values := result.sortValues(keys)
+		for i, key := range keys {
+			switch key.Column {
+			case "rank":
+				values[i] = result.Rank
+			case "similarity":
+				values[i] = result.Similarity
+			}
+		}
+		return values
+	})
+	metadata := pageMetadata(filters, totalRecords, next)
+
+	return results, counted, metadata, nil
+
+}
+
+// Export calls fn for every book matching the same criteria used by Search,
+// in the requested sort order. The rows are read from the database one at
+// a time as fn consumes them, so the whole catalog never has to be held
+// in memory. The caller owns ctx because an export runs for as long as
+// the client keeps reading
+func (c BookModel) Export(ctx context.Context, criteria BookSearchCriteria, filters Filters, fn func(*Book) error) error {
+
+	args := []any{criteria.Query, criteria.Language}
+	where := criteria.where(&args)
+
+	sqlQuery := fmt.Sprintf(`
+	SELECT id, title, authors, isbn, publication_date, genre, description, average_rating, language, work_id, version
+	FROM (
+		SELECT b.*,
+		       ts_rank(b.search_vector, q.tsq) AS rank,
+		       GREATEST(similarity(lower(b.title), lower($1)), similarity(lower(COALESCE(b.authors, '')), lower($1))) AS similarity
+		FROM books b, %s
+		WHERE %s
+	) matches
+	ORDER BY %s`, bookSearchQuery, where, orderBy(searchKeys(filters)))
+
+	rows, err := c.DB.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var book Book
-		err := rows.Scan(&totalRecords,
+		err := rows.Scan(
 			&book.ID,
 			&book.Title,
 			&book.Authors,
@@ -300,23 +677,75 @@ func (c BookModel) Search(title string, author string, genre string, filters Fil
 			&book.Genre,
 			&book.Description,
 			&book.AverageRating,
+			&book.Language,
+			&book.WorkID,
 			&book.Version,
 		)
 		if err != nil {
-			return nil, Metadata{}, err
+			return err
+		}
+		err = fn(&book)
+		if err != nil {
+			return err
 		}
-		// add the row to our slice
-		books = append(books, &book)
-	} // end of for loop
-
-	// after we exit the loop we need to check if it generated any errors
-	err = rows.Err()
-	if err != nil {
-		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return rows.Err()
+}
 
-	return books, metadata, nil
+// FindByISBN looks a book up by its (normalised) ISBN
+func (c BookModel) FindByISBN(isbn string) (*Book, error) {
+	query := `
+		 SELECT id, title, authors, isbn, publication_date, genre, description, average_rating, language, work_id, version
+		 FROM books
+		 WHERE isbn = $1 AND deleted_at IS NULL
+		 ORDER BY id
+		 LIMIT 1
+	   `
+	return c.findOne(query, NormalizeISBN(isbn))
+}
+
+// FindByTitleAndAuthor is used when we have no ISBN to go on. The title
+// has to match exactly (ignoring case) and the author has to be one of
+// the book's authors
+func (c BookModel) FindByTitleAndAuthor(title string, author string) (*Book, error) {
+	query := `
+		 SELECT id, title, authors, isbn, publication_date, genre, description, average_rating, language, work_id, version
+		 FROM books
+		 WHERE lower(title) = lower($1) AND deleted_at IS NULL
+		 AND lower(authors) LIKE '%' || lower($2) || '%'
+		 ORDER BY id
+		 LIMIT 1
+	   `
+	return c.findOne(query, strings.TrimSpace(title), strings.TrimSpace(author))
+}
+
+func (c BookModel) findOne(query string, args ...any) (*Book, error) {
+	var book Book
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(
+		&book.ID,
+		&book.Title,
+		&book.Authors,
+		&book.ISBN,
+		&book.PublicationDate,
+		&book.Genre,
+		&book.Description,
+		&book.AverageRating,
+		&book.Language,
+		&book.WorkID,
+		&book.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &book, nil
 }
@@ -0,0 +1,22 @@
+package data
+
+import "testing"
+
+func TestEscapeHeadline(t *testing.T) {
+	tests := []struct {
+		headline string
+		want     string
+	}{
+		{"a \x02dragon\x03 tale", "a <b>dragon</b> tale"},
+		{"<script>alert(1)</script> \x02fire\x03", "&lt;script&gt;alert(1)&lt;/script&gt; <b>fire</b>"},
+		{"<b>not ours</b> & \x02ours\x03", "&lt;b&gt;not ours&lt;/b&gt; &amp; <b>ours</b>"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got := escapeHeadline(tt.headline)
+		if got != tt.want {
+			t.Errorf("escapeHeadline(%q) = %q, want %q", tt.headline, got, tt.want)
+		}
+	}
+}
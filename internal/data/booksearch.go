@@ -0,0 +1,214 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// The facets search results can be broken down by
+var BookFacetNames = []string{"genre", "decade", "rating", "language"}
+
+// The SQL for the value of each facet. A book published in 1994 is in the
+// 1990 decade and a book rated 3.7 is in the 3 rating bucket
+var bookFacetExpressions = map[string]string{
+	"genre":    `b.genre`,
+	"decade":   `((substring(b.publication_date from '(\d{4})\s*$')::int / 10) * 10)::text`,
+	"rating":   `floor(b.average_rating)::int::text`,
+	"language": `b.language::text`,
+}
+
+// What a book search is looking for. Facets holds the values picked for
+// each facet: a book has to have one of the values picked for a facet
+// (OR within a facet) and match every facet that has a selection (AND
+// across facets)
+type BookSearchCriteria struct {
+	Query    string
+	Language string
+	Facets   map[string][]string
+	BookFilter
+}
+
+// BookFilter narrows a book listing, search or export down. The zero
+// value of a field means it is not filtered on. UserID is the caller, who
+// NotInMyLists and Status refer to
+type BookFilter struct {
+	MinRating    float64
+	MaxRating    float64
+	MinReviews   int
+	NotInMyLists bool
+	ReviewedBy   int64
+	Status       string
+	UserID       int64
+}
+
+// How many of the matching books have a facet value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+func ValidateBookFilter(v *validator.Validator, filter BookFilter) {
+	v.Check(filter.MinRating >= 0 && filter.MinRating <= 5, "min_rating", "must be between 0 and 5")
+	v.Check(filter.MaxRating >= 0 && filter.MaxRating <= 5, "max_rating", "must be between 0 and 5")
+	v.Check(filter.MinRating <= filter.MaxRating, "min_rating", "must not be greater than max_rating")
+	v.Check(filter.MinReviews >= 0, "min_reviews", "must not be negative")
+	v.Check(filter.ReviewedBy >= 0, "reviewed_by", "must be a valid user id")
+	if filter.Status != "" {
+		v.Check(validator.PermittedValue(filter.Status, ReadingStatuses...), "status", "must be 'want to read', 'currently reading' or 'completed'")
+	}
+}
+
+func ValidateBookSearchCriteria(v *validator.Validator, criteria BookSearchCriteria) {
+	v.Check(len(criteria.Query) <= 200, "q", "must not be more than 200 bytes long")
+	v.Check(validator.PermittedValue(criteria.Language, SearchLanguages...), "lang", "must be a supported search language")
+	ValidateBookFilter(v, criteria.BookFilter)
+
+	for _, value := range criteria.Facets["decade"] {
+		var decade int
+		_, err := fmt.Sscanf(value, "%d", &decade)
+		v.Check(err == nil && decade%10 == 0 && fmt.Sprint(decade) == value, "decade", "must contain decades such as 1990")
+	}
+	for _, value := range criteria.Facets["rating"] {
+		v.Check(validator.PermittedValue(value, "0", "1", "2", "3", "4", "5"), "rating", "must contain ratings from 0 to 5")
+	}
+	for _, value := range criteria.Facets["language"] {
+		v.Check(validator.PermittedValue(value, SearchLanguages...), "language", "must contain supported search languages")
+	}
+}
+
+// conditions returns the conditions of the filter on books b, adding the
+// values they need to args
+func (f BookFilter) conditions(args *[]any) []string {
+	conditions := []string{}
+	add := func(condition string, value any) {
+		*args = append(*args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(*args)))
+	}
+
+	if f.MinRating > 0 {
+		add("b.average_rating >= $%d", f.MinRating)
+	}
+	if f.MaxRating < 5 {
+		add("b.average_rating <= $%d", f.MaxRating)
+	}
+	if f.MinReviews > 0 {
+		add(`(SELECT COUNT(*) FROM bookreviews r
+		WHERE r.book_id = b.id AND r.deleted_at IS NULL AND r.hidden_at IS NULL) >= $%d`, f.MinReviews)
+	}
+	if f.ReviewedBy > 0 {
+		add(`EXISTS (SELECT 1 FROM bookreviews r
+		WHERE r.book_id = b.id AND r.user_id = $%d AND r.deleted_at IS NULL AND r.hidden_at IS NULL)`, f.ReviewedBy)
+	}
+	if f.NotInMyLists {
+		add(`NOT EXISTS (SELECT 1 FROM readinglist_books rb
+		INNER JOIN readinglists rl ON rl.id = rb.readinglist_id
+		WHERE rb.book_id = b.id AND rl.created_by = $%d AND rl.deleted_at IS NULL)`, f.UserID)
+	}
+	if f.Status != "" {
+		*args = append(*args, f.UserID, f.Status)
+		conditions = append(conditions, fmt.Sprintf(`EXISTS (SELECT 1 FROM readinglist_books rb
+		INNER JOIN readinglists rl ON rl.id = rb.readinglist_id
+		WHERE rb.book_id = b.id AND rl.created_by = $%d AND rl.deleted_at IS NULL
+		AND rb.status = $%d)`, len(*args)-1, len(*args)))
+	}
+	return conditions
+}
+
+// facetCondition is the condition for the values picked for a facet, or
+// "true" when nothing is picked. The values are added to args
+func (c BookSearchCriteria) facetCondition(facet string, args *[]any) string {
+	values := c.Facets[facet]
+	if len(values) == 0 {
+		return "true"
+	}
+	*args = append(*args, pq.Array(values))
+	return fmt.Sprintf("(%s) = ANY($%d)", bookFacetExpressions[facet], len(*args))
+}
+
+// where returns the conditions a book has to meet, adding the values
+// they need to args. args must already hold the query and language as
+// $1 and $2
+func (c BookSearchCriteria) where(args *[]any) string {
+	conditions := append([]string{bookSearchCondition}, c.BookFilter.conditions(args)...)
+	for _, facet := range BookFacetNames {
+		if len(c.Facets[facet]) > 0 {
+			conditions = append(conditions, c.facetCondition(facet, args))
+		}
+	}
+	return strings.Join(conditions, "\n\tAND ")
+}
+
+// facetColumns are the columns a search selects for every facet: the
+// book's value for it, named <facet>_value, and whether that value is one of those picked.
+// The picked values are added to args
+func (c BookSearchCriteria) facetColumns(args *[]any) []string {
+	columns := []string{}
+	for _, facet := range BookFacetNames {
+		columns = append(columns,
+			fmt.Sprintf("%s AS %s_value", bookFacetExpressions[facet], facet),
+			fmt.Sprintf("%s AS %s_ok", c.facetCondition(facet, args), facet))
+	}
+	return columns
+}
+
+// facetCounts is the query over matched that counts the books for each
+// value of the requested facets, as a single JSON array. A facet's counts
+// take every selection into account except its own, so picking a genre
+// still shows how many books the other genres would add
+func facetCounts(facets []string) string {
+	if len(facets) == 0 {
+		return "SELECT NULL::json AS counts"
+	}
+
+	counters := []string{}
+	for _, facet := range facets {
+		others := []string{fmt.Sprintf("%s_value IS NOT NULL", facet)}
+		for _, other := range BookFacetNames {
+			if other != facet {
+				others = append(others, other+"_ok")
+			}
+		}
+		counters = append(counters, fmt.Sprintf(`
+			SELECT '%s' AS facet, %s_value AS value, COUNT(*) AS count
+			FROM matched
+			WHERE %s
+			GROUP BY %s_value`, facet, facet, strings.Join(others, " AND "), facet))
+	}
+
+	return fmt.Sprintf(`SELECT json_agg(json_build_object('facet', facet, 'value', value, 'count', count)
+		       ORDER BY facet, count DESC, value) AS counts
+		FROM (%s
+		) counters`, strings.Join(counters, "\n\t\t\tUNION ALL"))
+}
+
+// decodeFacetCounts reads the JSON array facetCounts builds into the
+// counts for each requested facet. A facet nothing matched has no counts
+func decodeFacetCounts(facets []string, raw []byte) (map[string][]FacetCount, error) {
+	counts := make(map[string][]FacetCount)
+	if len(facets) == 0 {
+		return counts, nil
+	}
+	for _, facet := range facets {
+		counts[facet] = []FacetCount{}
+	}
+	if raw == nil {
+		return counts, nil
+	}
+
+	var rows []struct {
+		Facet string `json:"facet"`
+		FacetCount
+	}
+	err := json.Unmarshal(raw, &rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.Facet] = append(counts[row.Facet], row.FacetCount)
+	}
+	return counts, nil
+}
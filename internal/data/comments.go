@@ -0,0 +1,336 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mtechguy/test3/internal/policy"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// A comment on a review. Replies holds the comments answering it, so a
+// page of comments is a list of trees. A deleted comment keeps its place
+// in the tree for its replies but loses its body and author
+type Comment struct {
+	ID        int64      `json:"id"`
+	ReviewID  int64      `json:"review_id"`
+	ParentID  *int64     `json:"parent_id,omitempty"`
+	UserID    *int64     `json:"user_id,omitempty"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	Version   int        `json:"version"`
+	Replies   []*Comment `json:"replies,omitempty"`
+}
+
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// replies can't go deeper than this, which keeps threads readable and
+// the tree query bounded
+const maxCommentDepth = 10
+
+var ErrCommentTooDeep = errors.New("comment thread too deep")
+
+func ValidateComment(v *validator.Validator, comment *Comment, contentPolicy *policy.Policy) {
+	v.Check(strings.TrimSpace(comment.Body) != "", "body", "must be provided")
+	v.Check(len(comment.Body) <= 5000, "body", "must not be more than 5000 bytes long")
+	contentPolicy.Check(v, "body", comment.Body)
+}
+
+// Insert adds a comment to a review. A reply's parent has to be a comment
+// on the same review that hasn't been deleted, otherwise ErrRecordNotFound
+// is returned
+func (c CommentModel) Insert(comment *Comment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if comment.ParentID != nil {
+		var depth int
+		err := c.DB.QueryRowContext(ctx, `
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id, review_id FROM review_comments WHERE id = $1 AND deleted_at IS NULL
+				UNION ALL
+				SELECT p.id, p.parent_id, p.review_id
+				FROM review_comments p
+				INNER JOIN ancestors a ON a.parent_id = p.id
+			)
+			SELECT COUNT(*) FROM ancestors
+			HAVING bool_and(review_id = $2)
+		`, *comment.ParentID, comment.ReviewID).Scan(&depth)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		if depth == 0 {
+			return ErrRecordNotFound
+		}
+		if depth >= maxCommentDepth {
+			return ErrCommentTooDeep
+		}
+	}
+
+	query := `
+		INSERT INTO review_comments (review_id, parent_id, user_id, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at, version
+	`
+	args := []any{comment.ReviewID, comment.ParentID, comment.UserID, comment.Body}
+
+	return c.DB.QueryRowContext(ctx, query, args...).Scan(
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&comment.Version,
+	)
+}
+
+// Get returns a comment on a review that hasn't been deleted
+func (c CommentModel) Get(reviewID int64, id int64) (*Comment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, review_id, parent_id, user_id, body, created_at, updated_at, version
+		FROM review_comments
+		WHERE id = $1 AND review_id = $2 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var comment Comment
+	err := c.DB.QueryRowContext(ctx, query, id, reviewID).Scan(
+		&comment.ID,
+		&comment.ReviewID,
+		&comment.ParentID,
+		&comment.UserID,
+		&comment.Body,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&comment.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// Update changes the body of a comment, as long as nobody changed it since
+// it was read
+func (c CommentModel) Update(comment *Comment) error {
+	query := `
+		UPDATE review_comments
+		SET body = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND version = $3 AND deleted_at IS NULL
+		RETURNING updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, comment.Body, comment.ID, comment.Version).Scan(
+		&comment.UpdatedAt,
+		&comment.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete marks a comment as deleted. Its replies stay where they are
+func (c CommentModel) Delete(id int64) error {
+	query := `
+		UPDATE review_comments
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := c.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetThread returns a page of the comments on a review, oldest first.
+// The page is made of top level comments, each with all of its replies.
+// Deleted comments only show up when they have replies
+func (c CommentModel) GetThread(reviewID int64, filters Filters) ([]*Comment, Metadata, error) {
+	// a deleted top level comment without replies has nothing to show
+	where := `review_id = $1 AND parent_id IS NULL
+		AND (deleted_at IS NULL OR EXISTS (SELECT 1 FROM review_comments r WHERE r.parent_id = review_comments.id))`
+	args := []any{reviewID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	totalRecords, err := countRecords(ctx, c.DB, filters, `SELECT COUNT(*) FROM review_comments WHERE `+where, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	keys := filters.sortKeys()
+	keyset := keysetCondition(keys, filters.Cursor, &args)
+	args = append(args, filters.fetch(), filters.offset())
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at
+		FROM review_comments
+		WHERE %s
+		AND %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, where, keyset, orderBy(keys), len(args)-1, len(args))
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	type root struct {
+		id        int64
+		createdAt time.Time
+	}
+	roots := []root{}
+	for rows.Next() {
+		var r root
+		err := rows.Scan(&r.id, &r.createdAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		roots = append(roots, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	roots, next := nextCursor(roots, filters, func(r root) []any {
+		return []any{r.createdAt, r.id}
+	})
+
+	ids := make([]int64, len(roots))
+	for i, r := range roots {
+		ids[i] = r.id
+	}
+	comments, err := c.getTrees(ctx, ids)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return comments, pageMetadata(filters, totalRecords, next), nil
+}
+
+// getTrees reads the comments with the given ids and all their replies,
+// and returns them as trees in the order of ids
+func (c CommentModel) getTrees(ctx context.Context, ids []int64) ([]*Comment, error) {
+	query := `
+		WITH RECURSIVE thread AS (
+			SELECT *, 1 AS depth FROM review_comments WHERE id = ANY($1)
+			UNION ALL
+			SELECT r.*, t.depth + 1
+			FROM review_comments r
+			INNER JOIN thread t ON r.parent_id = t.id
+			WHERE t.depth < $2
+		)
+		SELECT id, review_id, parent_id, user_id, body, created_at, updated_at, deleted_at IS NOT NULL, version
+		FROM thread
+		ORDER BY created_at, id
+	`
+
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(ids), maxCommentDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]*Comment)
+	ordered := []*Comment{}
+	for rows.Next() {
+		var comment Comment
+		err := rows.Scan(
+			&comment.ID,
+			&comment.ReviewID,
+			&comment.ParentID,
+			&comment.UserID,
+			&comment.Body,
+			&comment.CreatedAt,
+			&comment.UpdatedAt,
+			&comment.Deleted,
+			&comment.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if comment.Deleted {
+			comment.Body = ""
+			comment.UserID = nil
+		}
+		byID[comment.ID] = &comment
+		ordered = append(ordered, &comment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// rows come oldest first, so replies are added in the order they
+	// were written
+	for _, comment := range ordered {
+		if comment.ParentID != nil {
+			if parent, ok := byID[*comment.ParentID]; ok {
+				parent.Replies = append(parent.Replies, comment)
+			}
+		}
+	}
+
+	trees := []*Comment{}
+	for _, id := range ids {
+		if comment, ok := byID[id]; ok && !prunedComment(comment) {
+			trees = append(trees, comment)
+		}
+	}
+	return trees, nil
+}
+
+// prunedComment drops the deleted replies of a comment that have nothing
+// left under them, and reports whether the comment itself should go
+func prunedComment(comment *Comment) bool {
+	replies := comment.Replies[:0]
+	for _, reply := range comment.Replies {
+		if !prunedComment(reply) {
+			replies = append(replies, reply)
+		}
+	}
+	comment.Replies = replies
+	return comment.Deleted && len(comment.Replies) == 0
+}
@@ -0,0 +1,135 @@
+package data
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// A Cursor marks the last row of a page. Keys holds that row's values for
+// each of the sort keys, the id last, and the next page starts right
+// after it. Sort is the sort the cursor was made for, as a cursor means
+// nothing under a different order
+type Cursor struct {
+	Sort string `json:"s"`
+	Keys []any  `json:"k"`
+}
+
+// Encode turns the cursor into the opaque token handed to clients. The
+// token is signed with secret so clients can't make up their own keys
+func (c Cursor) Encode(secret []byte) string {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		// the keys are ids, strings, numbers and times, all of which
+		// marshal
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signCursor(payload, secret))
+}
+
+// DecodeCursor checks the signature of a token made by Encode and returns
+// the cursor in it
+func DecodeCursor(token string, secret []byte) (*Cursor, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if !hmac.Equal(signature, signCursor(payload, secret)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	// numbers are kept as json.Number so ids go back to the database
+	// exactly as they came out
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	err = dec.Decode(&cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func signCursor(payload []byte, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// A sortKey is a column a listing is ordered by
+type sortKey struct {
+	Column string
+	Desc   bool
+}
+
+// orderBy turns the sort keys into the list of an ORDER BY
+func orderBy(keys []sortKey) string {
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		terms[i] = key.Column + " ASC"
+		if key.Desc {
+			terms[i] = key.Column + " DESC"
+		}
+	}
+	return strings.Join(terms, ", ")
+}
+
+// keysetCondition is the condition for the rows that come after the
+// cursor in the order of keys, or "true" when there is no cursor. The
+// cursor's keys are added to args
+func keysetCondition(keys []sortKey, cursor *Cursor, args *[]any) string {
+	if cursor == nil {
+		return "true"
+	}
+	if len(cursor.Keys) != len(keys) {
+		// only a cursor signed by us gets this far, so the keys can
+		// only be off if the sort keys themselves changed
+		return "false"
+	}
+
+	// (a, id) after (x, y) is a > x OR (a = x AND id > y), built up from
+	// the last key
+	condition := ""
+	for i := len(keys) - 1; i >= 0; i-- {
+		*args = append(*args, cursor.Keys[i])
+		operator := ">"
+		if keys[i].Desc {
+			operator = "<"
+		}
+		if condition == "" {
+			condition = fmt.Sprintf("%s %s $%d", keys[i].Column, operator, len(*args))
+			continue
+		}
+		condition = fmt.Sprintf("(%s %s $%d OR (%s = $%d AND %s))",
+			keys[i].Column, operator, len(*args), keys[i].Column, len(*args), condition)
+	}
+	return condition
+}
+
+// nextCursor is the cursor for the page after rows, if there is one.
+// The query asks for one row more than the page size, so a full page
+// plus that row means there is more to come. It returns the rows of the
+// page itself. keysOf gives the values of the sort keys of a row
+func nextCursor[T any](rows []T, filters Filters, keysOf func(T) []any) ([]T, *Cursor) {
+	if len(rows) <= filters.limit() {
+		return rows, nil
+	}
+	rows = rows[:filters.limit()]
+	return rows, &Cursor{Sort: filters.Sort, Keys: keysOf(rows[len(rows)-1])}
+}
@@ -0,0 +1,230 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrMergeIntoSelf = errors.New("a book cannot be merged into itself")
+
+// The part of a book shown when comparing possible duplicates
+type BookSummary struct {
+	ID      int64  `json:"id"`
+	Title   string `json:"title"`
+	Authors string `json:"authors"`
+	ISBN    string `json:"isbn"`
+}
+
+// A pair of books that look like the same book. Score goes from 0 to 1
+// and weighs a matching ISBN at 0.5, title similarity at 0.3 and the
+// overlap between the author lists at 0.2
+type DuplicateCandidate struct {
+	Book            BookSummary `json:"book"`
+	Duplicate       BookSummary `json:"duplicate"`
+	ISBNMatch       bool        `json:"isbn_match"`
+	TitleSimilarity float64     `json:"title_similarity"`
+	AuthorOverlap   float64     `json:"author_overlap"`
+	Score           float64     `json:"score"`
+}
+
+// FindDuplicates returns the pairs of books scoring at least minScore,
+// best matches first. Only pairs that share a normalised ISBN or have
+// trigram-similar titles are considered, which keeps the search on the
+// indexes instead of comparing every book with every other book
+func (c BookModel) FindDuplicates(minScore float64, filters Filters) ([]*DuplicateCandidate, Metadata, error) {
+	query := `
+	SELECT COUNT(*) OVER(), *
+	FROM (
+		SELECT b1_id, b1_title, b1_authors, b1_isbn, b2_id, b2_title, b2_authors, b2_isbn,
+		       isbn_match, title_similarity, author_overlap,
+		       0.5 * isbn_match::int + 0.3 * title_similarity + 0.2 * author_overlap AS score
+		FROM (
+			SELECT b1.id AS b1_id, b1.title AS b1_title, b1.authors AS b1_authors, b1.isbn AS b1_isbn,
+			       b2.id AS b2_id, b2.title AS b2_title, b2.authors AS b2_authors, b2.isbn AS b2_isbn,
+			       normalize_isbn(b1.isbn) = normalize_isbn(b2.isbn) AS isbn_match,
+			       similarity(lower(b1.title), lower(b2.title)) AS title_similarity,
+			       author_overlap(b1.authors, b2.authors) AS author_overlap
+			FROM books b1
+			INNER JOIN books b2 ON b1.id < b2.id AND b2.deleted_at IS NULL
+			AND (normalize_isbn(b1.isbn) = normalize_isbn(b2.isbn) OR lower(b1.title) % lower(b2.title))
+			WHERE b1.deleted_at IS NULL
+		) pairs
+	) scored
+	WHERE score >= $1
+	ORDER BY score DESC, b1_id, b2_id
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, minScore, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	candidates := []*DuplicateCandidate{}
+
+	for rows.Next() {
+		var candidate DuplicateCandidate
+		err := rows.Scan(&totalRecords,
+			&candidate.Book.ID,
+			&candidate.Book.Title,
+			&candidate.Book.Authors,
+			&candidate.Book.ISBN,
+			&candidate.Duplicate.ID,
+			&candidate.Duplicate.Title,
+			&candidate.Duplicate.Authors,
+			&candidate.Duplicate.ISBN,
+			&candidate.ISBNMatch,
+			&candidate.TitleSimilarity,
+			&candidate.AuthorOverlap,
+			&candidate.Score,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		candidates = append(candidates, &candidate)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return candidates, metadata, nil
+}
+
+// Merge folds the duplicate books into the surviving book in a single
+// transaction. Reviews move over, reading list and series entries move
+// over unless the survivor is already there, the duplicates are removed
+// and the survivor's average rating is worked out again. The survivor's
+// update and the duplicates' deletes go in the revision history in the
+// same transaction. It returns the survivor as it is after the merge
+func (c BookModel) Merge(survivorID int64, duplicateIDs []int64, actorID int64) (*Book, error) {
+	if slices.Contains(duplicateIDs, survivorID) {
+		return nil, ErrMergeIntoSelf
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := pq.Array(duplicateIDs)
+
+	// lock the books involved so nobody edits them halfway through
+	var found int
+	query := `
+		SELECT COUNT(*) FROM (
+			SELECT id FROM books
+			WHERE (id = $1 OR id = ANY($2)) AND deleted_at IS NULL
+			FOR UPDATE
+		) locked
+	`
+	err = tx.QueryRowContext(ctx, query, survivorID, ids).Scan(&found)
+	if err != nil {
+		return nil, err
+	}
+	if found != len(duplicateIDs)+1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// the books as they were, for the revision history
+	before := make(map[int64]*Book)
+	for _, id := range append([]int64{survivorID}, duplicateIDs...) {
+		before[id], err = getBook(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		// a user gets one review per book, so where they reviewed
+		// several of the duplicates only their newest review is kept
+		{`UPDATE bookreviews SET deleted_at = NOW(), version = version + 1
+		  WHERE id IN (
+		  	SELECT id FROM (
+		  		SELECT id, row_number() OVER (PARTITION BY user_id ORDER BY review_date DESC, id DESC) AS n
+		  		FROM bookreviews
+		  		WHERE (book_id = $1 OR book_id = ANY($2)) AND deleted_at IS NULL AND user_id IS NOT NULL
+		  	) ranked
+		  	WHERE n > 1
+		  )`, []any{survivorID, ids}},
+		{`UPDATE bookreviews SET book_id = $1 WHERE book_id = ANY($2)`, []any{survivorID, ids}},
+
+		// a list can hold several of the duplicates, keep the
+		// furthest status for the survivor
+		{`INSERT INTO readinglist_books (readinglist_id, book_id, status)
+		  SELECT DISTINCT ON (readinglist_id) readinglist_id, $1, status
+		  FROM readinglist_books
+		  WHERE book_id = ANY($2)
+		  ORDER BY readinglist_id, CASE status
+		  	WHEN 'completed' THEN 1
+		  	WHEN 'currently reading' THEN 2
+		  	ELSE 3
+		  END
+		  ON CONFLICT (readinglist_id, book_id) DO NOTHING`, []any{survivorID, ids}},
+		{`DELETE FROM readinglist_books WHERE book_id = ANY($1)`, []any{ids}},
+
+		{`INSERT INTO series_books (series_id, book_id, position)
+		  SELECT DISTINCT ON (series_id) series_id, $1, position
+		  FROM series_books
+		  WHERE book_id = ANY($2)
+		  ORDER BY series_id, position
+		  ON CONFLICT (series_id, book_id) DO NOTHING`, []any{survivorID, ids}},
+		{`DELETE FROM series_books WHERE book_id = ANY($1)`, []any{ids}},
+
+		// the duplicates' works go too once they have no editions left
+		{`WITH removed AS (
+		  	DELETE FROM books WHERE id = ANY($1) RETURNING work_id
+		  )
+		  DELETE FROM works
+		  WHERE id IN (SELECT work_id FROM removed)
+		  AND NOT EXISTS (SELECT 1 FROM books WHERE books.work_id = works.id AND books.id <> ALL($1))`, []any{ids}},
+
+		// the survivor's rating statistics are worked out the same way
+		// the review trigger does it, and the merge counts as an edit
+		{`SELECT refresh_book_rating($1)`, []any{survivorID}},
+		{`UPDATE books SET version = version + 1 WHERE id = $1`, []any{survivorID}},
+	}
+
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement.query, statement.args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	survivor, err := getBook(ctx, tx, survivorID)
+	if err != nil {
+		return nil, err
+	}
+	err = insertRevision(ctx, tx, RevisionBook, survivorID, RevisionUpdate, actorID, before[survivorID], survivor)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range duplicateIDs {
+		err = insertRevision(ctx, tx, RevisionBook, id, RevisionDelete, actorID, before[id], nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return survivor, tx.Commit()
+}
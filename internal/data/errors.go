@@ -10,3 +10,7 @@ var ErrDuplicateEmail = errors.New("duplicate email")
 var ErrEditConflict = errors.New("edit conflict")
 
 var ErrDuplicateBookInList = errors.New("duplicate book in reading list")
+
+var ErrDuplicateReview = errors.New("duplicate review")
+
+var ErrDuplicateFlag = errors.New("duplicate flag")
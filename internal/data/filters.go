@@ -1,6 +1,8 @@
 package data
 
 import (
+	"context"
+	"database/sql"
 	"strings"
 
 	"github.com/mtechguy/test3/internal/validator"
@@ -13,15 +15,18 @@ type Filters struct {
 	PageSize     int // How many records per page.
 	Sort         string
 	SortSafeList []string // allowed sort fields
-
+	Cursor       *Cursor  // where the page starts, used instead of Page
+	IncludeTotal bool     // whether to count every matching record
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int     `json:"current_page,omitempty"`
+	PageSize     int     `json:"page_size,omitempty"`
+	FirstPage    int     `json:"first_page,omitempty"`
+	LastPage     int     `json:"last_page,omitempty"`
+	TotalRecords int     `json:"total_records,omitempty"`
+	NextCursor   string  `json:"next_cursor,omitempty"`
+	Next         *Cursor `json:"-"` // signed into NextCursor by the handler
 }
 
 // ValidateFilters checks the validity of pagination parameters.
@@ -32,7 +37,10 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort",
 		"invalid sort value")
-
+	if f.Cursor != nil {
+		v.Check(f.Page == 1, "page", "must not be used with a cursor")
+		v.Check(f.Cursor.Sort == f.Sort, "cursor", "was made for a different sort")
+	}
 }
 
 func (f Filters) sortColumn() string {
@@ -53,6 +61,18 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// sortKeys are the columns the sort orders by. The id comes last to
+// break ties, so every row has its own place in the order
+func (f Filters) sortKeys() []sortKey {
+	if f.sortColumn() == "id" {
+		return []sortKey{{Column: "id", Desc: f.sortDirection() == "DESC"}}
+	}
+	return []sortKey{
+		{Column: f.sortColumn(), Desc: f.sortDirection() == "DESC"},
+		{Column: "id"},
+	}
+}
+
 // limit returns the number of records per page.
 func (f Filters) limit() int {
 	return f.PageSize
@@ -60,9 +80,47 @@ func (f Filters) limit() int {
 
 // offset calculates the number of records to skip for pagination.
 func (f Filters) offset() int {
+	if f.Cursor != nil {
+		return 0
+	}
 	return (f.Page - 1) * f.PageSize
 }
 
+// fetch is how many records a query asks for: the page and one more to
+// tell whether there is a next page
+func (f Filters) fetch() int {
+	return f.PageSize + 1
+}
+
+// pageMetadata generates the metadata of a page read with a cursor or a
+// page number. The total is only there when the client asked for it
+func pageMetadata(filters Filters, totalRecords int, next *Cursor) Metadata {
+	metadata := Metadata{
+		PageSize: filters.PageSize,
+		Next:     next,
+	}
+	if filters.Cursor == nil {
+		metadata.CurrentPage = filters.Page
+	}
+	if filters.IncludeTotal && totalRecords > 0 {
+		metadata.FirstPage = 1
+		metadata.LastPage = (totalRecords + filters.PageSize - 1) / filters.PageSize
+		metadata.TotalRecords = totalRecords
+	}
+	return metadata
+}
+
+// countRecords runs a COUNT(*) query for the total of a listing, but
+// only when the client asked for it, as counting a big table is slow
+func countRecords(ctx context.Context, db *sql.DB, filters Filters, query string, args ...any) (int, error) {
+	if !filters.IncludeTotal {
+		return 0, nil
+	}
+	var total int
+	err := db.QueryRowContext(ctx, query, args...).Scan(&total)
+	return total, err
+}
+
 // calculateMetaData generates pagination metadata.
 func calculateMetaData(totalRecords int, currentPage int, pageSize int) Metadata {
 	if totalRecords == 0 {
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// the states an import job moves through
+const (
+	ImportJobPending   = "pending"
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+	ImportJobFailed    = "failed"
+)
+
+// we keep the first few row errors only, a broken file would
+// otherwise produce one error for every row
+const maxImportJobErrors = 100
+
+type ImportJob struct {
+	ID             int64            `json:"id"`
+	UserID         int64            `json:"user_id"`
+	Source         string           `json:"source"`
+	Status         string           `json:"status"`
+	TotalRows      int              `json:"total_rows"`
+	ProcessedRows  int              `json:"processed_rows"`
+	BooksCreated   int              `json:"books_created"`
+	BooksMatched   int              `json:"books_matched"`
+	ListEntries    int              `json:"list_entries"`
+	ReviewsCreated int              `json:"reviews_created"`
+	Errors         []ImportJobError `json:"errors"`
+	CreatedAt      time.Time        `json:"created_at"`
+	FinishedAt     *time.Time       `json:"finished_at,omitempty"`
+}
+
+type ImportJobError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+type ImportJobModel struct {
+	DB *sql.DB
+}
+
+// AddError records a problem with one row of the import
+func (j *ImportJob) AddError(row int, message string) {
+	if len(j.Errors) < maxImportJobErrors {
+		j.Errors = append(j.Errors, ImportJobError{Row: row, Message: message})
+	}
+}
+
+func (m ImportJobModel) Insert(job *ImportJob) error {
+	query := `
+		INSERT INTO import_jobs (user_id, source, status, total_rows)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	args := []any{job.UserID, job.Source, job.Status, job.TotalRows}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	job.Errors = []ImportJobError{}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.CreatedAt)
+}
+
+// Get returns an import job, but only to the user who started it
+func (m ImportJobModel) Get(id int64, userID int64) (*ImportJob, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, user_id, source, status, total_rows, processed_rows, books_created,
+		       books_matched, list_entries, reviews_created, errors, created_at, finished_at
+		FROM import_jobs
+		WHERE id = $1 AND user_id = $2
+	`
+	var job ImportJob
+	var jobErrors []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Source,
+		&job.Status,
+		&job.TotalRows,
+		&job.ProcessedRows,
+		&job.BooksCreated,
+		&job.BooksMatched,
+		&job.ListEntries,
+		&job.ReviewsCreated,
+		&jobErrors,
+		&job.CreatedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(jobErrors, &job.Errors)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Update saves the progress of a running job. Once the job has
+// completed or failed the finish time is stamped as well
+func (m ImportJobModel) Update(job *ImportJob) error {
+	jobErrors, err := json.Marshal(job.Errors)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE import_jobs
+		SET status = $1, processed_rows = $2, books_created = $3, books_matched = $4,
+		    list_entries = $5, reviews_created = $6, errors = $7,
+		    finished_at = CASE WHEN $1 IN ('completed', 'failed') THEN NOW() END
+		WHERE id = $8
+		RETURNING finished_at
+	`
+	args := []any{job.Status, job.ProcessedRows, job.BooksCreated, job.BooksMatched,
+		job.ListEntries, job.ReviewsCreated, jobErrors, job.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&job.FinishedAt)
+}
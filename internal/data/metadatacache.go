@@ -0,0 +1,51 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// MetadataCacheModel keeps the records returned by a metadata provider.
+// It satisfies the metadata.Cache interface
+type MetadataCacheModel struct {
+	DB *sql.DB
+}
+
+func (m MetadataCacheModel) Get(isbn string, provider string, maxAge time.Duration) ([]byte, error) {
+	query := `
+		SELECT payload
+		FROM metadata_cache
+		WHERE isbn = $1 AND provider = $2 AND fetched_at > $3
+	`
+	var payload []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, isbn, provider, time.Now().Add(-maxAge)).Scan(&payload)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+func (m MetadataCacheModel) Put(isbn string, provider string, payload []byte) error {
+	query := `
+		INSERT INTO metadata_cache (isbn, provider, payload)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (isbn, provider)
+		DO UPDATE SET payload = EXCLUDED.payload, fetched_at = NOW()
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, isbn, provider, payload)
+	return err
+}
@@ -0,0 +1,230 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// the reasons a member can give for flagging a review
+var FlagReasons = []string{"spam", "abuse", "spoiler", "off_topic", "other"}
+
+// what a moderator can do with a flagged review
+const (
+	ModerationHide    = "hide"
+	ModerationRestore = "restore"
+	ModerationDelete  = "delete"
+)
+
+var ModerationActions = []string{ModerationHide, ModerationRestore, ModerationDelete}
+
+// A member's report that a review breaks the rules
+type ReviewFlag struct {
+	ID        int64     `json:"id"`
+	ReviewID  int64     `json:"review_id"`
+	UserID    int64     `json:"user_id"`
+	Reason    string    `json:"reason"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// A review waiting for a moderator, with a summary of its open flags.
+// Reasons counts the flags given for each reason
+type ModerationItem struct {
+	Review         *Review        `json:"review"`
+	FlagCount      int            `json:"flag_count"`
+	Reasons        map[string]int `json:"reasons"`
+	FirstFlaggedAt time.Time      `json:"first_flagged_at"`
+}
+
+func ValidateReviewFlag(v *validator.Validator, flag *ReviewFlag) {
+	v.Check(flag.Reason != "", "reason", "must be provided")
+	v.Check(validator.PermittedValue(flag.Reason, FlagReasons...), "reason", "invalid reason")
+	v.Check(len(flag.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+}
+
+// InsertFlag records a member's flag on a review. A member has one open
+// flag per review, a second one returns ErrDuplicateFlag
+func (c ReviewModel) InsertFlag(flag *ReviewFlag) error {
+	query := `
+		INSERT INTO review_flags (review_id, user_id, reason, note)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	args := []any{flag.ReviewID, flag.UserID, flag.Reason, flag.Note}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&flag.ID, &flag.CreatedAt)
+	if err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "review_flags_open_key"` {
+			return ErrDuplicateFlag
+		}
+		return err
+	}
+	return nil
+}
+
+// the reviews with open flags, one row per review
+const moderationQueue = `(
+	SELECT r.id, r.book_id, r.user_id, r.rating, r.review, r.review_date, r.version,
+		r.helpful_votes, r.unhelpful_votes, r.helpful_score, r.comment_count, r.edited_at, r.hidden_at IS NOT NULL AS hidden,
+		COUNT(f.id) AS flag_count, MIN(f.created_at) AS first_flagged_at, array_agg(f.reason) AS reasons
+	FROM bookreviews r
+	INNER JOIN review_flags f ON f.review_id = r.id AND f.resolved_at IS NULL
+	WHERE r.deleted_at IS NULL
+	GROUP BY r.id
+) queue`
+
+// GetModerationQueue returns a page of the reviews that have open flags
+func (c ReviewModel) GetModerationQueue(filters Filters) ([]*ModerationItem, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	totalRecords, err := countRecords(ctx, c.DB, filters, `SELECT COUNT(*) FROM `+moderationQueue)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	args := []any{}
+	keys := filters.sortKeys()
+	keyset := keysetCondition(keys, filters.Cursor, &args)
+	args = append(args, filters.fetch(), filters.offset())
+
+	query := fmt.Sprintf(`
+		SELECT id, book_id, user_id, rating, review, review_date, version, helpful_votes, unhelpful_votes,
+			helpful_score, comment_count, edited_at, hidden, flag_count, first_flagged_at, reasons
+		FROM %s
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, moderationQueue, keyset, orderBy(keys), len(args)-1, len(args))
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	items := []*ModerationItem{}
+	for rows.Next() {
+		var review Review
+		var item ModerationItem
+		var reasons []string
+		err := rows.Scan(
+			&review.ReviewID,
+			&review.BookID,
+			&review.UserID,
+			&review.Rating,
+			&review.ReviewText,
+			&review.ReviewDate,
+			&review.Version,
+			&review.HelpfulVotes,
+			&review.UnhelpfulVotes,
+			&review.HelpfulScore,
+			&review.CommentCount,
+			&review.EditedAt,
+			&review.Hidden,
+			&item.FlagCount,
+			&item.FirstFlaggedAt,
+			pq.Array(&reasons),
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		item.Review = &review
+		item.Reasons = make(map[string]int)
+		for _, reason := range reasons {
+			item.Reasons[reason]++
+		}
+		items = append(items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	items, next := nextCursor(items, filters, func(item *ModerationItem) []any {
+		values := map[string]any{
+			"flag_count":       item.FlagCount,
+			"first_flagged_at": item.FirstFlaggedAt,
+		}
+		return []any{values[keys[0].Column], item.Review.ReviewID}
+	})
+
+	return items, pageMetadata(filters, totalRecords, next), nil
+}
+
+// Moderate hides, restores or deletes a review for a moderator, resolves
+// the open flags on it and records the change in the revision history,
+// all in one go. Restoring a review makes it visible again. A deleted
+// review remembers the moderator, so that only a moderator can take it
+// out of the trash. review is the review as it was read, and
+// ErrEditConflict is returned if it has changed since
+func (c ReviewModel) Moderate(review *Review, moderatorID int64, action string) error {
+	reviewID := review.ReviewID
+	var query string
+	args := []any{reviewID, review.Version}
+	switch action {
+	case ModerationHide:
+		query = `UPDATE bookreviews SET hidden_at = NOW(), version = version + 1 WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+	case ModerationRestore:
+		query = `UPDATE bookreviews SET hidden_at = NULL, version = version + 1 WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+	case ModerationDelete:
+		query = `UPDATE bookreviews SET deleted_at = NOW(), deleted_by = $3, version = version + 1 WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+		args = append(args, moderatorID)
+	default:
+		return fmt.Errorf("unknown moderation action %q", action)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE review_flags
+		SET resolved_at = NOW(), resolved_by = $2, resolution = $3
+		WHERE review_id = $1 AND resolved_at IS NULL
+	`, reviewID, moderatorID, action)
+	if err != nil {
+		return err
+	}
+
+	if action == ModerationDelete {
+		err = insertRevision(ctx, tx, RevisionReview, reviewID, RevisionDelete, moderatorID, review, nil)
+	} else {
+		var after *Review
+		after, err = getReview(ctx, tx, reviewID)
+		if err != nil {
+			return err
+		}
+		err = insertRevision(ctx, tx, RevisionReview, reviewID, RevisionUpdate, moderatorID, review, after)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// How many reviews a book's own average is weighed against. A book with
+// this many reviews is ranked halfway between its average and the
+// average of the whole catalog
+const ratingPriorWeight = 10
+
+// bookRatingPrior is the average rating of every review in the catalog,
+// the rating a book is assumed to have before it has any reviews
+const bookRatingPrior = `(
+	SELECT COALESCE(SUM(average_rating * review_count) / NULLIF(SUM(review_count), 0), 0) AS mean
+	FROM books
+	WHERE deleted_at IS NULL
+) prior`
+
+// weightedRating is the Bayesian average of a book b: its reviews plus
+// ratingPriorWeight reviews at the catalog's average. Books with only a
+// couple of glowing reviews don't outrank books with hundreds of good
+// ones. It is rounded so it survives a trip through a cursor
+var weightedRating = fmt.Sprintf(`ROUND((prior.mean * %d + b.average_rating * b.review_count) / (%d + b.review_count), 4)`,
+	ratingPriorWeight, ratingPriorWeight)
+
+// The rating statistics of a book. Distribution holds how many reviews
+// gave the book each number of stars
+type BookRatings struct {
+	BookID         int64         `json:"book_id"`
+	AverageRating  float64       `json:"average_rating"`
+	WeightedRating float64       `json:"weighted_rating"`
+	ReviewCount    int           `json:"review_count"`
+	Distribution   map[int]int64 `json:"distribution"`
+}
+
+// GetRatings returns the rating statistics of a book
+func (c BookModel) GetRatings(id int64) (*BookRatings, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+	SELECT b.id, b.average_rating, %s, b.review_count, b.rating_counts
+	FROM books b, %s
+	WHERE b.id = $1 AND b.deleted_at IS NULL`, weightedRating, bookRatingPrior)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ratings BookRatings
+	var counts []int64
+	err := c.DB.QueryRowContext(ctx, query, id).Scan(
+		&ratings.BookID,
+		&ratings.AverageRating,
+		&ratings.WeightedRating,
+		&ratings.ReviewCount,
+		pq.Array(&counts),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	ratings.Distribution = make(map[int]int64, len(counts))
+	for i, count := range counts {
+		ratings.Distribution[i+1] = count
+	}
+
+	return &ratings, nil
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mtechguy/test3/internal/policy"
 	"github.com/mtechguy/test3/internal/validator"
 )
 
@@ -28,11 +29,14 @@ type BooksInList struct {
 	Version       int16  `json:"version"`
 }
 
+// the statuses a book in a reading list can have
+var ReadingStatuses = []string{"want to read", "currently reading", "completed"}
+
 type ReadingListModel struct {
 	DB *sql.DB
 }
 
-func ValidateReadingList(v *validator.Validator, list *ReadingList) {
+func ValidateReadingList(v *validator.Validator, list *ReadingList, contentPolicy *policy.Policy) {
 	// Validate Name
 	v.Check(strings.TrimSpace(list.Name) != "", "name", "must be provided")
 	v.Check(len(list.Name) <= 100, "name", "must not be more than 100 characters long")
@@ -41,6 +45,10 @@ func ValidateReadingList(v *validator.Validator, list *ReadingList) {
 	v.Check(strings.TrimSpace(list.Description) != "", "description", "must be provided")
 	v.Check(len(list.Description) <= 200, "description", "must not be more than 200 characters long")
 
+	// Lists are shown to other members, so both go through the content policy
+	contentPolicy.Check(v, "name", list.Name)
+	contentPolicy.Check(v, "description", list.Description)
+
 	// Validate CreatedBy (Foreign Key)
 	v.Check(list.CreatedBy > 0, "created_by", "must be a valid user ID")
 }
@@ -48,19 +56,27 @@ func ValidateReadingList(v *validator.Validator, list *ReadingList) {
 // validate if status for book being added to reading list is correct
 func ValidateReadingStatus(v *validator.Validator, readingStatus string) {
 	v.Check(readingStatus != "", "status", "must be provided")
-	v.Check(readingStatus == "currently reading" || readingStatus == "completed",
+	v.Check(validator.PermittedValue(readingStatus, ReadingStatuses...),
 		"status",
-		"status must be of values 'completed' or 'currently reading'")
+		"status must be of values 'want to read', 'currently reading' or 'completed'")
 }
 
-func (c ReadingListModel) Insert(list *ReadingList) error {
+// Insert adds the list and records the insert in the revision history in
+// the same transaction. actorID is the user adding it
+func (c ReadingListModel) Insert(list *ReadingList, actorID int64) error {
 	// Create a context with a 3-second timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// Check if the CreatedBy user exists
 	var createdByExists bool
-	err := c.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", list.CreatedBy).Scan(&createdByExists)
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", list.CreatedBy).Scan(&createdByExists)
 	if err != nil {
 		return fmt.Errorf("error checking created_by user: %w", err)
 	}
@@ -76,34 +92,44 @@ func (c ReadingListModel) Insert(list *ReadingList) error {
 
 	args := []any{list.Name, list.Description, list.CreatedBy}
 
-	err = c.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.Version)
 	if err != nil {
 		return fmt.Errorf("error inserting reading list: %w", err)
 	}
 
-	return nil
+	err = insertRevision(ctx, tx, RevisionList, list.ID, RevisionInsert, actorID, nil, list)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Get a specific Comment from the comments table
 func (c ReadingListModel) Get(id int64) (*ReadingList, error) {
+	// Set a 3-second context/timer
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getReadingList(ctx, c.DB, id)
+}
+
+// getReadingList reads a list with q, which is the database or a
+// transaction
+func getReadingList(ctx context.Context, q rowQuerier, id int64) (*ReadingList, error) {
 	// check if the id is valid
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	// the SQL query to be executed against the database table
 	query := `
-		 SELECT  id, name, description, created_by, books, status, version
+		 SELECT  id, name, description, created_by, version
 		 FROM readinglists
-		 WHERE id = $1
+		 WHERE id = $1 AND deleted_at IS NULL
 	   `
 	// declare a variable of type Comment to store the returned comment
 	var list ReadingList
 
-	// Set a 3-second context/timer
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := c.DB.QueryRowContext(ctx, query, id).Scan(
+	err := q.QueryRowContext(ctx, query, id).Scan(
 		&list.ID,
 		&list.Name,
 		&list.Description,
@@ -123,42 +149,72 @@ func (c ReadingListModel) Get(id int64) (*ReadingList, error) {
 	return &list, nil
 }
 
-func (c ReadingListModel) Update(list *ReadingList) error {
+// Update saves the changes to the list and records them in the revision
+// history in the same transaction. before is the list as it was read
+func (c ReadingListModel) Update(list *ReadingList, before *ReadingList, actorID int64) error {
 	// The SQL query to be executed against the database table
 	// Every time we make an update, we increment the version number
 	query := `
 			UPDATE readinglists
 			SET  name = $1, description = $2, created_by = $3, version = version + 1
-			WHERE id = $4
+			WHERE id = $4 AND version = $5 AND deleted_at IS NULL
 			RETURNING version
 			`
 
-	args := []any{list.Name, list.Description, list.CreatedBy, list.ID}
+	args := []any{list.Name, list.Description, list.CreatedBy, list.ID, list.Version}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// no row means the list was changed (or deleted) since it was read
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
 
+	err = insertRevision(ctx, tx, RevisionList, list.ID, RevisionUpdate, actorID, before, list)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (c ReadingListModel) Delete(id int64) error {
+// Delete moves the list to the trash and records that in the revision
+// history in the same transaction. list is the list as it was read
+func (c ReadingListModel) Delete(list *ReadingList, actorID int64) error {
 
 	// check if the id is valid
-	if id < 1 {
+	if list.ID < 1 {
 		return ErrRecordNotFound
 	}
-	// the SQL query to be executed against the database table
+	// the list is only marked as deleted so that its books are still
+	// there if it is restored
 	query := `
-        DELETE FROM readinglists
-        WHERE id = $1
+        UPDATE readinglists
+        SET deleted_at = NOW(), version = version + 1
+        WHERE id = $1 AND deleted_at IS NULL
 		`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// ExecContext does not return any rows unlike QueryRowContext.
 	// It only returns  information about the the query execution
 	// such as how many rows were affected
-	result, err := c.DB.ExecContext(ctx, query, id)
+	result, err := tx.ExecContext(ctx, query, list.ID)
 	if err != nil {
 		return err
 	}
@@ -173,39 +229,98 @@ func (c ReadingListModel) Delete(id int64) error {
 		return ErrRecordNotFound
 	}
 
-	return nil
+	err = insertRevision(ctx, tx, RevisionList, list.ID, RevisionDelete, actorID, list, nil)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Restore takes a reading list back out of the trash and records that in
+// the revision history in the same transaction. It returns the list as
+// it is now
+func (c ReadingListModel) Restore(id int64, actorID int64) (*ReadingList, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+        UPDATE readinglists
+        SET deleted_at = NULL, version = version + 1
+        WHERE id = $1 AND deleted_at IS NOT NULL
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	list, err := getReadingList(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = insertRevision(ctx, tx, RevisionList, id, RevisionRestore, actorID, nil, list)
+	if err != nil {
+		return nil, err
+	}
+	return list, tx.Commit()
 }
 
 func (c ReadingListModel) GetAll(name string, filters Filters) ([]*ReadingList, Metadata, error) {
 
-	// the SQL query to be executed against the database table
-	query := fmt.Sprintf(`
-	SELECT COUNT(*) OVER(), id, name, description, created_by, books, status, version
-	FROM readinglists
-	WHERE (to_tsvector('simple', name) @@
-		  plainto_tsquery('simple', $1) OR $1 = '')
-	AND (to_tsvector('simple', status) @@
-		 plainto_tsquery('simple', $2) OR $2 = '')
-	ORDER BY %s %s, id ASC
-	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	where := `deleted_at IS NULL
+	AND (to_tsvector('simple', name) @@
+		  plainto_tsquery('simple', $1) OR $1 = '')`
+	args := []any{name}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	totalRecords, err := countRecords(ctx, c.DB, filters, `SELECT COUNT(*) FROM readinglists WHERE `+where, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	keys := filters.sortKeys()
+	keyset := keysetCondition(keys, filters.Cursor, &args)
+	args = append(args, filters.fetch(), filters.offset())
+
+	// the SQL query to be executed against the database table
+	query := fmt.Sprintf(`
+	SELECT id, name, description, created_by, version
+	FROM readinglists
+	WHERE %s
+	AND %s
+	ORDER BY %s
+	LIMIT $%d OFFSET $%d`, where, keyset, orderBy(keys), len(args)-1, len(args))
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
-	totalRecords := 0
 	lists := []*ReadingList{}
 
 	for rows.Next() {
 		var list ReadingList
 		// Scan the values, including the pointer for 'books'
-		err := rows.Scan(&totalRecords,
+		err := rows.Scan(
 			&list.ID,
 			&list.Name,
 			&list.Description,
@@ -224,7 +339,13 @@ func (c ReadingListModel) GetAll(name string, filters Filters) ([]*ReadingList,
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	lists, next := nextCursor(lists, filters, func(list *ReadingList) []any {
+		if len(keys) == 1 {
+			return []any{list.ID}
+		}
+		return []any{list.Name, list.ID}
+	})
+	metadata := pageMetadata(filters, totalRecords, next)
 	return lists, metadata, nil
 }
 
@@ -285,7 +406,7 @@ func (b *ReadingListModel) ReadingListExist(id int64) error {
 	query := `
 	SELECT id 
 	FROM readinglists
-	WHERE id = $1`
+	WHERE id = $1 AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -294,3 +415,55 @@ func (b *ReadingListModel) ReadingListExist(id int64) error {
 
 	return b.DB.QueryRowContext(ctx, query, id).Scan(&ID)
 }
+
+// GetOrCreateByName returns the reading list with the given name that
+// belongs to the user, creating it first if the user does not have one
+func (c ReadingListModel) GetOrCreateByName(userID int64, name string, description string) (*ReadingList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	list := ReadingList{
+		Name:        name,
+		Description: description,
+		CreatedBy:   int(userID),
+	}
+
+	query := `
+		SELECT id, description, version
+		FROM readinglists
+		WHERE created_by = $1 AND name = $2 AND deleted_at IS NULL
+		ORDER BY id
+		LIMIT 1
+		`
+	err := c.DB.QueryRowContext(ctx, query, userID, name).Scan(&list.ID, &list.Description, &list.Version)
+	if err == nil {
+		return &list, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	err = c.Insert(&list, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// SetBookStatus adds a book to a reading list, or changes its status
+// if the book is already on the list
+func (c *ReadingListModel) SetBookStatus(book *BooksInList) error {
+	query := `
+	INSERT INTO readinglist_books (readinglist_id, book_id, status)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (readinglist_id, book_id)
+	DO UPDATE SET status = EXCLUDED.status, version = readinglist_books.version + 1
+	RETURNING version
+	`
+	args := []any{book.ReadingListID, book.BookID, book.Status}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return c.DB.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+}
@@ -5,36 +5,77 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/mtechguy/test3/internal/markup"
+	"github.com/mtechguy/test3/internal/policy"
 	"github.com/mtechguy/test3/internal/validator"
 )
 
 // Review struct
 type Review struct {
-	ReviewID   int64     `json:"id"`      // bigserial primary key
-	BookID     int64     `json:"book_id"` // foreign key referencing products
-	UserID     int64     `json:"user_id"`
-	Rating     int64     `json:"rating"` // integer with a constraint (1-5)
-	ReviewText string    `json:"review"` // non-null text field
-	ReviewDate time.Time `json:"-"`      // timestamp with timezone, default now()
-	Version    int       `json:"version"`
+	ReviewID   int64      `json:"id"`      // bigserial primary key
+	BookID     int64      `json:"book_id"` // foreign key referencing products
+	UserID     int64      `json:"user_id"`
+	Rating     int64      `json:"rating"`      // integer with a constraint (1-5)
+	ReviewText string     `json:"review"`      // non-null text field
+	ReviewHTML string     `json:"review_html"` // ReviewText rendered by RenderText
+	ReviewDate time.Time  `json:"review_date"` // timestamp with timezone, default now()
+	EditedAt   *time.Time `json:"edited_at"`   // when the rating or text last changed, nil if never
+	Version    int        `json:"version"`
+	// vote tallies, kept up to date by the database as votes come in
+	HelpfulVotes   int     `json:"helpful_votes"`
+	UnhelpfulVotes int     `json:"unhelpful_votes"`
+	HelpfulScore   float64 `json:"-"` // Wilson score lower bound the -helpful sort uses
+	CommentCount   int     `json:"comment_count"`
+	Hidden         bool    `json:"hidden,omitempty"` // hidden by a moderator, only its author still sees it
 }
 
 type ReviewModel struct {
 	DB *sql.DB
 }
 
-func ValidateReview(v *validator.Validator, review *Review) {
-	v.Check(review.UserID > 0, "user_id", "must be provided")
+func ValidateReview(v *validator.Validator, review *Review, contentPolicy *policy.Policy) {
 	v.Check(review.ReviewText != "", "review_text", "must be provided")
+	ValidateImportedReview(v, review, contentPolicy)
+}
+
+// ValidateImportedReview checks a review brought in by an import, where a
+// star rating without any text is normal
+func ValidateImportedReview(v *validator.Validator, review *Review, contentPolicy *policy.Policy) {
+	v.Check(review.UserID > 0, "user_id", "must be provided")
+	v.Check(len(review.ReviewText) <= 10000, "review_text", "must not be more than 10000 bytes long")
+	if err := markup.Validate(review.ReviewText); err != nil {
+		v.AddError("review_text", err.Error())
+	}
+	contentPolicy.Check(v, "review_text", review.ReviewText)
 
 	v.Check(review.BookID > 0, "book_id", "must be a positive integer")
 
 	v.Check(review.Rating >= 1 && review.Rating <= 5, "rating", "must be between 1 and 5")
 }
 
-func (c ReviewModel) InsertReview(review *Review) error {
+// RenderText fills in ReviewHTML. With hideSpoilers the spoilers are
+// taken out of the raw text as well
+func (r *Review) RenderText(hideSpoilers bool) {
+	r.ReviewText, r.ReviewHTML = renderReviewText(r.ReviewText, hideSpoilers)
+}
+
+// renderReviewText returns the raw text to show, spoilers redacted when
+// asked, and the text as HTML
+func renderReviewText(text string, hideSpoilers bool) (string, string) {
+	html := markup.Render(text, markup.Options{HideSpoilers: hideSpoilers})
+	if hideSpoilers {
+		text = markup.RedactSpoilers(text)
+	}
+	return text, html
+}
+
+// InsertReview adds the review and records the insert in the revision
+// history in the same transaction. actorID is the user adding it
+func (c ReviewModel) InsertReview(review *Review, actorID int64) error {
 	query := `
 		INSERT INTO bookreviews (book_id, user_id, rating, review)
 		VALUES ($1, $2, $3, $4)
@@ -45,26 +86,103 @@ func (c ReviewModel) InsertReview(review *Review) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
 		&review.ReviewID,
 		&review.ReviewDate,
 		&review.Version)
+	if err != nil {
+		if isDuplicateReview(err) {
+			return ErrDuplicateReview
+		}
+		return err
+	}
+
+	err = insertRevision(ctx, tx, RevisionReview, review.ReviewID, RevisionInsert, actorID, nil, review)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
-func (c ReviewModel) GetReview(id int64) (*Review, error) {
-	if id < 1 {
-		return nil, ErrRecordNotFound
+
+// a user has one review of a book that isn't deleted
+func isDuplicateReview(err error) bool {
+	return err.Error() == `pq: duplicate key value violates unique constraint "bookreviews_book_user_key"`
+}
+
+// UpsertReview creates the user's review of the book, or replaces the
+// rating and text of the one they already have, and records that in the
+// revision history in the same transaction. before is the review being
+// replaced, nil when there was none. It reports whether the review was
+// created
+func (c ReviewModel) UpsertReview(review *Review, before *Review) (bool, error) {
+	query := `
+		INSERT INTO bookreviews (book_id, user_id, rating, review)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (book_id, user_id) WHERE deleted_at IS NULL
+		DO UPDATE SET rating = EXCLUDED.rating, review = EXCLUDED.review, version = bookreviews.version + 1,
+			edited_at = CASE
+				WHEN (bookreviews.rating, bookreviews.review) IS DISTINCT FROM (EXCLUDED.rating, EXCLUDED.review) THEN NOW()
+				ELSE bookreviews.edited_at
+			END
+		RETURNING id, review_date, version, helpful_votes, unhelpful_votes, helpful_score, comment_count, edited_at, xmax = 0
+	`
+	args := []any{review.BookID, review.UserID, review.Rating, review.ReviewText}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// xmax is only 0 for a freshly inserted row
+	var created bool
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
+		&review.ReviewID,
+		&review.ReviewDate,
+		&review.Version,
+		&review.HelpfulVotes,
+		&review.UnhelpfulVotes,
+		&review.HelpfulScore,
+		&review.CommentCount,
+		&review.EditedAt,
+		&created)
+	if err != nil {
+		return false, err
 	}
+
+	if created {
+		err = insertRevision(ctx, tx, RevisionReview, review.ReviewID, RevisionInsert, review.UserID, nil, review)
+	} else {
+		err = insertRevision(ctx, tx, RevisionReview, review.ReviewID, RevisionUpdate, review.UserID, before, review)
+	}
+	if err != nil {
+		return false, err
+	}
+	return created, tx.Commit()
+}
+
+// GetUserBookReview returns the user's review of the book
+func (c ReviewModel) GetUserBookReview(bookID int64, userID int64) (*Review, error) {
 	query := `
-		SELECT  id, book_id, user_id, rating, review, review_date, version
+		SELECT id, book_id, user_id, rating, review, review_date, version, helpful_votes, unhelpful_votes, helpful_score, comment_count, edited_at, hidden_at IS NOT NULL
 		FROM bookreviews
-		WHERE id = $1
+		WHERE book_id = $1 AND user_id = $2 AND deleted_at IS NULL
 	`
 	var review Review
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := c.DB.QueryRowContext(ctx, query, id).Scan(
+	err := c.DB.QueryRowContext(ctx, query, bookID, userID).Scan(
 		&review.ReviewID,
 		&review.BookID,
 		&review.UserID,
@@ -72,6 +190,12 @@ func (c ReviewModel) GetReview(id int64) (*Review, error) {
 		&review.ReviewText,
 		&review.ReviewDate,
 		&review.Version,
+		&review.HelpfulVotes,
+		&review.UnhelpfulVotes,
+		&review.HelpfulScore,
+		&review.CommentCount,
+		&review.EditedAt,
+		&review.Hidden,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -81,27 +205,140 @@ func (c ReviewModel) GetReview(id int64) (*Review, error) {
 	}
 	return &review, nil
 }
+func (c ReviewModel) GetReview(id int64) (*Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getReview(ctx, c.DB, id)
+}
 
-func (c ReviewModel) GetAllBookReviews(bookID int64) ([]*Review, error) {
-	if bookID < 1 {
+// getReview reads a review with q, which is the database or a transaction
+func getReview(ctx context.Context, q rowQuerier, id int64) (*Review, error) {
+	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
-
 	query := `
-		SELECT id, book_id, user_id, rating, review, review_date, version
+		SELECT  id, book_id, user_id, rating, review, review_date, version, helpful_votes, unhelpful_votes, helpful_score, comment_count, edited_at, hidden_at IS NOT NULL
 		FROM bookreviews
-		WHERE book_id = $1
-		ORDER BY review_date DESC
+		WHERE id = $1 AND deleted_at IS NULL
 	`
+	var review Review
+
+	err := q.QueryRowContext(ctx, query, id).Scan(
+		&review.ReviewID,
+		&review.BookID,
+		&review.UserID,
+		&review.Rating,
+		&review.ReviewText,
+		&review.ReviewDate,
+		&review.Version,
+		&review.HelpfulVotes,
+		&review.UnhelpfulVotes,
+		&review.HelpfulScore,
+		&review.CommentCount,
+		&review.EditedAt,
+		&review.Hidden,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &review, nil
+}
+
+// ReviewFilter narrows a review listing down. MinRating and MaxRating
+// are inclusive and HasText, when set, keeps only the reviews that do or
+// don't have any text
+type ReviewFilter struct {
+	MinRating int64
+	MaxRating int64
+	HasText   *bool
+}
+
+func ValidateReviewFilter(v *validator.Validator, filter ReviewFilter) {
+	v.Check(filter.MinRating >= 1 && filter.MinRating <= 5, "min_rating", "must be between 1 and 5")
+	v.Check(filter.MaxRating >= 1 && filter.MaxRating <= 5, "max_rating", "must be between 1 and 5")
+	v.Check(filter.MinRating <= filter.MaxRating, "min_rating", "must not be greater than max_rating")
+}
+
+// conditions returns the conditions of the filter, adding the values
+// they need to args
+func (f ReviewFilter) conditions(args *[]any) []string {
+	conditions := []string{}
+	if f.MinRating > 1 {
+		*args = append(*args, f.MinRating)
+		conditions = append(conditions, fmt.Sprintf("rating >= $%d", len(*args)))
+	}
+	if f.MaxRating < 5 {
+		*args = append(*args, f.MaxRating)
+		conditions = append(conditions, fmt.Sprintf("rating <= $%d", len(*args)))
+	}
+	if f.HasText != nil {
+		if *f.HasText {
+			conditions = append(conditions, "COALESCE(review, '') <> ''")
+		} else {
+			conditions = append(conditions, "COALESCE(review, '') = ''")
+		}
+	}
+	return conditions
+}
+
+// the columns behind the sort keys of a review listing
+var reviewSortColumns = map[string]string{
+	"id":      "id",
+	"date":    "review_date",
+	"rating":  "rating",
+	"helpful": "helpful_score",
+}
+
+func reviewSortKeys(filters Filters) []sortKey {
+	keys := filters.sortKeys()
+	keys[0].Column = reviewSortColumns[keys[0].Column]
+	return keys
+}
+
+// GetAllBookReviews returns a page of the reviews of a book
+func (c ReviewModel) GetAllBookReviews(bookID int64, filter ReviewFilter, filters Filters) ([]*Review, Metadata, error) {
+	if bookID < 1 {
+		return nil, Metadata{}, ErrRecordNotFound
+	}
+	return c.list("book_id = $1", []any{bookID}, filter, filters)
+}
 
-	var reviews []*Review
+// list returns a page of the reviews matching condition, which uses the
+// first values of args
+func (c ReviewModel) list(condition string, args []any, filter ReviewFilter, filters Filters) ([]*Review, Metadata, error) {
+	conditions := append([]string{condition, "deleted_at IS NULL", "hidden_at IS NULL"}, filter.conditions(&args)...)
+	where := strings.Join(conditions, "\n\t\tAND ")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query, bookID)
+	totalRecords, err := countRecords(ctx, c.DB, filters, `SELECT COUNT(*) FROM bookreviews WHERE `+where, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
+	}
+
+	keys := reviewSortKeys(filters)
+	keyset := keysetCondition(keys, filters.Cursor, &args)
+	args = append(args, filters.fetch(), filters.offset())
+
+	query := fmt.Sprintf(`
+		SELECT id, book_id, user_id, rating, review, review_date, version, helpful_votes, unhelpful_votes, helpful_score, comment_count, edited_at
+		FROM bookreviews
+		WHERE %s
+		AND %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, where, keyset, orderBy(keys), len(args)-1, len(args))
+
+	reviews := []*Review{}
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
@@ -115,49 +352,104 @@ func (c ReviewModel) GetAllBookReviews(bookID int64) ([]*Review, error) {
 			&review.ReviewText,
 			&review.ReviewDate,
 			&review.Version,
+			&review.HelpfulVotes,
+			&review.UnhelpfulVotes,
+			&review.HelpfulScore,
+			&review.CommentCount,
+			&review.EditedAt,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 		reviews = append(reviews, &review)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
-	return reviews, nil
+	reviews, next := nextCursor(reviews, filters, func(review *Review) []any {
+		values := make([]any, len(keys))
+		for i, key := range keys {
+			switch key.Column {
+			case "id":
+				values[i] = review.ReviewID
+			case "review_date":
+				values[i] = review.ReviewDate
+			case "rating":
+				values[i] = review.Rating
+			case "helpful_score":
+				values[i] = review.HelpfulScore
+			}
+		}
+		return values
+	})
+
+	return reviews, pageMetadata(filters, totalRecords, next), nil
 }
 
-func (c ReviewModel) UpdateReview(review *Review) error {
+// UpdateReview saves the new rating and text of the review and records
+// them in the revision history in the same transaction. before is the
+// review as it was read
+func (c ReviewModel) UpdateReview(review *Review, before *Review, actorID int64) error {
 	query := `
 		UPDATE bookreviews
-		SET  rating = $1, review = $2, version = version + 1
-		WHERE id = $3
-		RETURNING version
+		SET  rating = $1, review = $2, version = version + 1,
+		     edited_at = CASE WHEN rating IS DISTINCT FROM $1 OR review IS DISTINCT FROM $2 THEN NOW() ELSE edited_at END
+		WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+		RETURNING version, edited_at
 	`
 
-	args := []any{review.Rating, review.ReviewText, review.ReviewID}
+	args := []any{review.Rating, review.ReviewText, review.ReviewID, review.Version}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(&review.Version)
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// no row means the review was changed (or deleted) since it was read
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.Version, &review.EditedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	err = insertRevision(ctx, tx, RevisionReview, review.ReviewID, RevisionUpdate, actorID, before, review)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (c ReviewModel) DeleteReview(id int64) error {
-	if id < 1 {
+// DeleteReview moves the review to the trash and records that in the
+// revision history in the same transaction. review is the review as it
+// was read
+func (c ReviewModel) DeleteReview(review *Review, actorID int64) error {
+	if review.ReviewID < 1 {
 		return ErrRecordNotFound
 	}
 	query := `
-		DELETE FROM bookreviews
-		WHERE id = $1
+		UPDATE bookreviews
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := c.DB.ExecContext(ctx, query, id)
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, review.ReviewID)
 	if err != nil {
 		return err
 	}
@@ -170,11 +462,66 @@ func (c ReviewModel) DeleteReview(id int64) error {
 		return ErrRecordNotFound
 	}
 
-	return nil
+	err = insertRevision(ctx, tx, RevisionReview, review.ReviewID, RevisionDelete, actorID, review, nil)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RestoreReview takes a review back out of the trash and records that in
+// the revision history in the same transaction. It returns the review as
+// it is now, or fails with ErrDuplicateReview when the user has reviewed
+// the book again since
+func (c ReviewModel) RestoreReview(id int64, actorID int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		UPDATE bookreviews
+		SET deleted_at = NULL, deleted_by = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		// the user may have written a new review since
+		if isDuplicateReview(err) {
+			return nil, ErrDuplicateReview
+		}
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	review, err := getReview(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = insertRevision(ctx, tx, RevisionReview, id, RevisionRestore, actorID, nil, review)
+	if err != nil {
+		return nil, err
+	}
+	return review, tx.Commit()
 }
 
 func (m *BookModel) BookExists(productID int64) (bool, error) {
-	query := `SELECT EXISTS (SELECT 1 FROM books WHERE id = $1)`
+	query := `SELECT EXISTS (SELECT 1 FROM books WHERE id = $1 AND deleted_at IS NULL)`
 	var exists bool
 	err := m.DB.QueryRow(query, productID).Scan(&exists)
 	if err != nil {
@@ -185,10 +532,21 @@ func (m *BookModel) BookExists(productID int64) (bool, error) {
 
 func (m *ReviewModel) Exists(id int64) (bool, error) {
 	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM bookreviews WHERE id = $1)`
+	query := `SELECT EXISTS(SELECT 1 FROM bookreviews WHERE id = $1 AND deleted_at IS NULL)`
 	err := m.DB.QueryRow(query, id).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
+
+// HasReviewed reports whether the user has already reviewed the book
+func (m *ReviewModel) HasReviewed(bookID int64, userID int64) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM bookreviews WHERE book_id = $1 AND user_id = $2 AND deleted_at IS NULL)`
+	err := m.DB.QueryRow(query, bookID, userID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
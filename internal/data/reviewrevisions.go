@@ -0,0 +1,106 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// One version of the rating and text of a review, taken from the review's
+// revision history. Version is the version the review was at, which it
+// stayed at from WrittenAt until ReplacedAt. ReplacedAt is nil for the
+// version the review is at now
+type ReviewRevision struct {
+	ReviewID   int64      `json:"review_id"`
+	Version    int        `json:"version"`
+	Rating     int64      `json:"rating"`
+	ReviewText string     `json:"review"`
+	ReviewHTML string     `json:"review_html"`
+	WrittenAt  time.Time  `json:"written_at"`
+	ReplacedAt *time.Time `json:"replaced_at"`
+}
+
+// RenderText fills in ReviewHTML, like Review.RenderText
+func (r *ReviewRevision) RenderText(hideSpoilers bool) {
+	r.ReviewText, r.ReviewHTML = renderReviewText(r.ReviewText, hideSpoilers)
+}
+
+// the revisions of a review that wrote or changed its rating or text. A
+// moderator hiding it, or a save that changed nothing, isn't a version.
+// The versions come from the revision history every review change is
+// already recorded in rather than a table of their own, so they rely on
+// the snapshot and diff keys of Review, which TestReviewRevisionKeys pins
+const reviewVersions = `(
+	SELECT id, (snapshot->>'version')::integer AS version, (snapshot->>'rating')::bigint AS rating,
+		COALESCE(snapshot->>'review', '') AS review, created_at AS written_at,
+		LEAD(created_at) OVER (ORDER BY id) AS replaced_at
+	FROM revisions
+	WHERE entity_type = 'review' AND entity_id = $1
+	AND (action = 'insert' OR (action IN ('update', 'revert') AND (diff ? 'rating' OR diff ? 'review')))
+) versions`
+
+// GetRevisions returns a page of the versions of a review
+func (c ReviewModel) GetRevisions(reviewID int64, filters Filters) ([]*ReviewRevision, Metadata, error) {
+	args := []any{reviewID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	totalRecords, err := countRecords(ctx, c.DB, filters, `SELECT COUNT(*) FROM `+reviewVersions, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	keys := filters.sortKeys()
+	keyset := keysetCondition(keys, filters.Cursor, &args)
+	args = append(args, filters.fetch(), filters.offset())
+
+	query := fmt.Sprintf(`
+		SELECT id, version, rating, review, written_at, replaced_at
+		FROM %s
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, reviewVersions, keyset, orderBy(keys), len(args)-1, len(args))
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// the id only orders revisions, it means nothing to the client
+	type row struct {
+		id       int64
+		revision *ReviewRevision
+	}
+	found := []row{}
+	for rows.Next() {
+		r := row{revision: &ReviewRevision{ReviewID: reviewID}}
+		err := rows.Scan(
+			&r.id,
+			&r.revision.Version,
+			&r.revision.Rating,
+			&r.revision.ReviewText,
+			&r.revision.WrittenAt,
+			&r.revision.ReplacedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		found = append(found, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	found, next := nextCursor(found, filters, func(r row) []any {
+		return []any{r.revision.Version, r.id}
+	})
+
+	revisions := make([]*ReviewRevision, len(found))
+	for i, r := range found {
+		revisions[i] = r.revision
+	}
+	return revisions, pageMetadata(filters, totalRecords, next), nil
+}
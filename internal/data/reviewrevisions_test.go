@@ -0,0 +1,37 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// reviewVersions reads the version, rating and text of a review out of
+// the revision snapshots and spots the updates that changed them by their
+// diff keys. Renaming those fields would quietly empty the history
+func TestReviewRevisionKeys(t *testing.T) {
+	before := &Review{ReviewID: 1, BookID: 2, UserID: 3, Rating: 3, ReviewText: "good", Version: 1}
+	after := &Review{ReviewID: 1, BookID: 2, UserID: 3, Rating: 5, ReviewText: "great", Version: 2}
+
+	revision, err := NewRevision(RevisionReview, 1, RevisionUpdate, 3, before, after)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var snapshot map[string]any
+	err = json.Unmarshal(revision.Snapshot, &snapshot)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]any{"version": 2.0, "rating": 5.0, "review": "great"}
+	for key, value := range want {
+		if snapshot[key] != value {
+			t.Errorf("snapshot[%q] = %v, want %v", key, snapshot[key], value)
+		}
+	}
+
+	for _, key := range []string{"rating", "review"} {
+		if _, found := revision.Diff[key]; !found {
+			t.Errorf("diff has no %q key: %v", key, revision.Diff)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// The kinds of record whose changes are kept
+const (
+	RevisionBook   = "book"
+	RevisionList   = "list"
+	RevisionReview = "review"
+)
+
+// What happened to the record
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+)
+
+// The old and new value of a single field
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// One change to a book, reading list or review. ActorID is 0 when the
+// user who made the change has since been removed
+type Revision struct {
+	ID         int64                  `json:"id"`
+	EntityType string                 `json:"entity_type"`
+	EntityID   int64                  `json:"entity_id"`
+	Action     string                 `json:"action"`
+	ActorID    int64                  `json:"actor_id,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+	Diff       map[string]FieldChange `json:"diff"`
+	Snapshot   json.RawMessage        `json:"snapshot"`
+}
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// NewRevision builds the revision for a change from before to after.
+// before is nil for an insert and after is nil for a delete. The version
+// is left out of the diff since it changes every time anyway
+func NewRevision(entityType string, entityID int64, action string, actorID int64, before any, after any) (*Revision, error) {
+	from, err := revisionFields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := revisionFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]FieldChange)
+	for key, value := range to {
+		if key != "version" && !reflect.DeepEqual(from[key], value) {
+			diff[key] = FieldChange{From: from[key], To: value}
+		}
+	}
+	for key, value := range from {
+		if _, found := to[key]; !found && key != "version" {
+			diff[key] = FieldChange{From: value, To: nil}
+		}
+	}
+
+	snapshot := after
+	if isNilRecord(snapshot) {
+		snapshot = before
+	}
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Revision{
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		ActorID:    actorID,
+		Diff:       diff,
+		Snapshot:   raw,
+	}, nil
+}
+
+// revisionFields turns a record into its JSON fields so that records of
+// any type can be compared the same way the client sees them
+func revisionFields(record any) (map[string]any, error) {
+	fields := make(map[string]any)
+	if isNilRecord(record) {
+		return fields, nil
+	}
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func isNilRecord(record any) bool {
+	if record == nil {
+		return true
+	}
+	value := reflect.ValueOf(record)
+	return value.Kind() == reflect.Pointer && value.IsNil()
+}
+
+// insertRevision records a change in the revision history. The models
+// call it with the transaction that makes the change, so the change is
+// never saved without its revision or the other way round
+func insertRevision(ctx context.Context, tx *sql.Tx, entityType string, entityID int64, action string, actorID int64, before any, after any) error {
+	revision, err := NewRevision(entityType, entityID, action, actorID, before, after)
+	if err != nil {
+		return err
+	}
+	diff, err := json.Marshal(revision.Diff)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO revisions (entity_type, entity_id, action, actor_id, diff, snapshot)
+		VALUES ($1, $2, $3, NULLIF($4::bigint, 0), $5, $6)
+	`
+	args := []any{revision.EntityType, revision.EntityID, revision.Action, revision.ActorID, diff, []byte(revision.Snapshot)}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// rowQuerier is what a single row read needs, so that it can run on the
+// database or inside a transaction
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (m RevisionModel) Get(id int64) (*Revision, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, entity_type, entity_id, action, COALESCE(actor_id, 0), created_at, diff, snapshot
+		FROM revisions
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	revision, err := scanRevision(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return revision, nil
+}
+
+// GetAllForEntity returns the history of one record, newest change first
+func (m RevisionModel) GetAllForEntity(entityType string, entityID int64, filters Filters) ([]*Revision, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), id, entity_type, entity_id, action, COALESCE(actor_id, 0), created_at, diff, snapshot
+		FROM revisions
+		WHERE entity_type = $1 AND entity_id = $2
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, entityType, entityID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		var revision Revision
+		var diff, snapshot []byte
+		err := rows.Scan(&totalRecords,
+			&revision.ID,
+			&revision.EntityType,
+			&revision.EntityID,
+			&revision.Action,
+			&revision.ActorID,
+			&revision.CreatedAt,
+			&diff,
+			&snapshot,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revision.Snapshot = snapshot
+		err = json.Unmarshal(diff, &revision.Diff)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+func scanRevision(row *sql.Row) (*Revision, error) {
+	var revision Revision
+	var diff, snapshot []byte
+	err := row.Scan(
+		&revision.ID,
+		&revision.EntityType,
+		&revision.EntityID,
+		&revision.Action,
+		&revision.ActorID,
+		&revision.CreatedAt,
+		&diff,
+		&snapshot,
+	)
+	if err != nil {
+		return nil, err
+	}
+	revision.Snapshot = snapshot
+	err = json.Unmarshal(diff, &revision.Diff)
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
@@ -0,0 +1,215 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+type Series struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	Version     int       `json:"version"`
+}
+
+// A book in a series together with its place in the reading order. The
+// status is the caller's reading status for the book, if they have one
+type SeriesBook struct {
+	Position float64 `json:"position"`
+	Status   string  `json:"status,omitempty"`
+	*Book
+}
+
+type SeriesModel struct {
+	DB *sql.DB
+}
+
+func ValidateSeries(v *validator.Validator, series *Series) {
+	v.Check(strings.TrimSpace(series.Name) != "", "name", "must be provided")
+	v.Check(len(series.Name) <= 255, "name", "must not be more than 255 bytes long")
+	v.Check(len(series.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+}
+
+func ValidateSeriesPosition(v *validator.Validator, position float64) {
+	v.Check(position > 0, "position", "must be greater than zero")
+	v.Check(position < 10000, "position", "must be less than 10000")
+	v.Check(hasTwoDecimals(position), "position", "must have at most two decimal places")
+}
+
+// hasTwoDecimals reports whether x has at most two decimal places. Most
+// such values have no exact float representation (1.1*100 is
+// 110.00000000000001), so x*100 only has to be close to a whole number
+func hasTwoDecimals(x float64) bool {
+	scaled := x * 100
+	return math.Abs(scaled-math.Round(scaled)) < 1e-9
+}
+
+func (m SeriesModel) Insert(series *Series) error {
+	query := `
+		INSERT INTO series (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, series.Name, series.Description).Scan(
+		&series.ID,
+		&series.CreatedAt,
+		&series.Version)
+}
+
+func (m SeriesModel) Get(id int64) (*Series, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, name, description, created_at, version
+		FROM series
+		WHERE id = $1
+	`
+	var series Series
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&series.ID,
+		&series.Name,
+		&series.Description,
+		&series.CreatedAt,
+		&series.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &series, nil
+}
+
+// GetBooks returns the books of a series in reading order. Each book
+// carries the user's furthest reading status for it across all of the
+// user's reading lists
+func (m SeriesModel) GetBooks(seriesID int64, userID int64) ([]*SeriesBook, error) {
+	query := `
+		SELECT sb.position, COALESCE(s.status, ''),
+		       b.id, b.title, b.authors, b.isbn, b.publication_date, b.genre, b.description,
+		       b.average_rating, b.language, b.work_id, b.version
+		FROM series_books sb
+		INNER JOIN books b ON b.id = sb.book_id AND b.deleted_at IS NULL
+		LEFT JOIN LATERAL (
+			SELECT rb.status
+			FROM readinglist_books rb
+			INNER JOIN readinglists l ON l.id = rb.readinglist_id
+			WHERE rb.book_id = sb.book_id AND l.created_by = $2 AND l.deleted_at IS NULL
+			ORDER BY CASE rb.status
+				WHEN 'completed' THEN 1
+				WHEN 'currently reading' THEN 2
+				ELSE 3
+			END
+			LIMIT 1
+		) s ON true
+		WHERE sb.series_id = $1
+		ORDER BY sb.position, b.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, seriesID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []*SeriesBook{}
+	for rows.Next() {
+		seriesBook := SeriesBook{Book: &Book{}}
+		err := rows.Scan(
+			&seriesBook.Position,
+			&seriesBook.Status,
+			&seriesBook.ID,
+			&seriesBook.Title,
+			&seriesBook.Authors,
+			&seriesBook.ISBN,
+			&seriesBook.PublicationDate,
+			&seriesBook.Genre,
+			&seriesBook.Description,
+			&seriesBook.AverageRating,
+			&seriesBook.Language,
+			&seriesBook.WorkID,
+			&seriesBook.Book.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, &seriesBook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// NextUnread returns the first book in reading order that the user has
+// not completed, or nil once they have finished the series
+func NextUnread(books []*SeriesBook) *SeriesBook {
+	for _, book := range books {
+		if book.Status != "completed" {
+			return book
+		}
+	}
+	return nil
+}
+
+// SetBook adds a book to the series at the given position, or moves it
+// there if it is already part of the series
+func (m SeriesModel) SetBook(seriesID int64, bookID int64, position float64) error {
+	query := `
+		INSERT INTO series_books (series_id, book_id, position)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (series_id, book_id)
+		DO UPDATE SET position = EXCLUDED.position
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, seriesID, bookID, position)
+	return err
+}
+
+func (m SeriesModel) RemoveBook(seriesID int64, bookID int64) error {
+	query := `
+		DELETE FROM series_books
+		WHERE series_id = $1 AND book_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, seriesID, bookID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+func TestValidateSeriesPosition(t *testing.T) {
+	tests := []struct {
+		position float64
+		valid    bool
+	}{
+		{1, true},
+		{1.1, true},
+		{1.15, true},
+		{2.55, true},
+		{0.29, true},
+		{4.35, true},
+		{9999.99, true},
+		{1.001, false},
+		{2.555, false},
+		{0, false},
+		{-1, false},
+		{10000, false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateSeriesPosition(v, tt.position)
+		if v.IsEmpty() != tt.valid {
+			t.Errorf("position %v: valid = %v, want %v (%v)", tt.position, v.IsEmpty(), tt.valid, v.Errors)
+		}
+	}
+}
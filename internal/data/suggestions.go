@@ -0,0 +1,85 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// The kinds of term the search box can suggest
+var SuggestionKinds = []string{"title", "author", "genre"}
+
+type Suggestion struct {
+	Kind       string `json:"kind"`
+	Term       string `json:"term"`
+	Popularity int64  `json:"popularity"`
+}
+
+type SuggestionModel struct {
+	DB *sql.DB
+}
+
+// Get returns the most popular terms that start with prefix, or have a
+// word that does. Terms that start with the prefix come first. An empty
+// kind suggests every kind of term
+func (m SuggestionModel) Get(prefix string, kind string, limit int) ([]*Suggestion, error) {
+	query := `
+		SELECT kind, term, popularity
+		FROM search_suggestions
+		WHERE (kind = $3 OR $3 = '')
+		AND (key LIKE $1 OR key LIKE $2)
+		ORDER BY key LIKE $1 DESC, popularity DESC, term
+		LIMIT $4
+	`
+	pattern := escapeLike(strings.ToLower(strings.TrimSpace(prefix)))
+
+	// matching inside a term needs the trigram index, which cannot help
+	// with fewer than three characters, so short prefixes only match the
+	// start of a term
+	wordPattern := pattern + "%"
+	if len([]rune(prefix)) >= 3 {
+		wordPattern = "% " + pattern + "%"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pattern+"%", wordPattern, kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+	for rows.Next() {
+		var suggestion Suggestion
+		err := rows.Scan(&suggestion.Kind, &suggestion.Term, &suggestion.Popularity)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// Refresh rebuilds the suggestions from the current catalog. Readers
+// keep seeing the old suggestions until the new ones are ready
+func (m SuggestionModel) Refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY search_suggestions`)
+	return err
+}
+
+// escapeLike stops the characters LIKE treats specially from matching
+// anything but themselves
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
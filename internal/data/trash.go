@@ -0,0 +1,175 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The kinds of item that can end up in the trash
+var TrashTypes = []string{"book", "list", "review"}
+
+// Something that was deleted and can still be restored until the trash
+// is purged. Label is whatever best identifies the item to a person
+type TrashItem struct {
+	Type      string    `json:"type"`
+	ID        int64     `json:"id"`
+	Label     string    `json:"label"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// How many rows a purge removed for good
+type PurgeResult struct {
+	Books   int64 `json:"books"`
+	Lists   int64 `json:"lists"`
+	Reviews int64 `json:"reviews"`
+}
+
+type TrashModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns the deleted books, lists and reviews, most recently
+// deleted first. An empty itemType returns every kind of item
+func (m TrashModel) GetAll(itemType string, filters Filters) ([]*TrashItem, Metadata, error) {
+	query := `
+	SELECT COUNT(*) OVER(), type, id, label, deleted_at
+	FROM (
+		SELECT 'book' AS type, id, title AS label, deleted_at
+		FROM books WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'list', id, COALESCE(name, ''), deleted_at
+		FROM readinglists WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'review', id, left(COALESCE(review, ''), 80), deleted_at
+		FROM bookreviews WHERE deleted_at IS NOT NULL
+	) trash
+	WHERE (type = $1 OR $1 = '')
+	ORDER BY deleted_at DESC, type, id
+	LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, itemType, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*TrashItem{}
+
+	for rows.Next() {
+		var item TrashItem
+		err := rows.Scan(&totalRecords,
+			&item.Type,
+			&item.ID,
+			&item.Label,
+			&item.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		items = append(items, &item)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return items, metadata, nil
+}
+
+// Owner returns the id of the user an item in the trash belongs to: the
+// creator of a list or the author of a review. Books belong to nobody,
+// so their owner is 0, and so does a review a moderator deleted.
+// ErrRecordNotFound means the item isn't in the trash
+func (m TrashModel) Owner(itemType string, id int64) (int64, error) {
+	var query string
+	switch itemType {
+	case "book":
+		query = `SELECT 0 FROM books WHERE id = $1 AND deleted_at IS NOT NULL`
+	case "list":
+		query = `SELECT COALESCE(created_by, 0) FROM readinglists WHERE id = $1 AND deleted_at IS NOT NULL`
+	case "review":
+		query = `
+			SELECT CASE WHEN deleted_by IS NULL THEN COALESCE(user_id, 0) ELSE 0 END
+			FROM bookreviews WHERE id = $1 AND deleted_at IS NOT NULL
+		`
+	default:
+		return 0, fmt.Errorf("unknown trash type %q", itemType)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var owner int64
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+	return owner, nil
+}
+
+// Purge permanently removes everything that has been in the trash for
+// longer than retention. Removing a book takes its reviews and list
+// entries with it, and a work left without any editions goes as well
+func (m TrashModel) Purge(retention time.Duration) (PurgeResult, error) {
+	var result PurgeResult
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	cutoff := time.Now().Add(-retention)
+
+	statements := []struct {
+		query string
+		count *int64
+	}{
+		{`DELETE FROM bookreviews WHERE deleted_at < $1`, &result.Reviews},
+		{`DELETE FROM readinglists WHERE deleted_at < $1`, &result.Lists},
+		{`DELETE FROM books WHERE deleted_at < $1`, &result.Books},
+	}
+
+	for _, statement := range statements {
+		res, err := tx.ExecContext(ctx, statement.query, cutoff)
+		if err != nil {
+			return result, err
+		}
+		*statement.count, err = res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if result.Books > 0 {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM works
+			WHERE NOT EXISTS (SELECT 1 FROM books WHERE books.work_id = works.id)
+		`)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
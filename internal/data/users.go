@@ -24,12 +24,23 @@ type User struct {
 }
 
 type UserReview struct {
-	ReviewID   int64     `json:"id"`      // bigserial primary key
-	BookID     int64     `json:"book_id"` // foreign key referencing products
-	Rating     int64     `json:"rating"`  // integer with a constraint (1-5)
-	ReviewText string    `json:"review"`  // non-null text field
-	ReviewDate time.Time `json:"-"`       // timestamp with timezone, default now()
-	Version    int       `json:"version"`
+	ReviewID   int64      `json:"id"`      // bigserial primary key
+	BookID     int64      `json:"book_id"` // foreign key referencing products
+	Rating     int64      `json:"rating"`  // integer with a constraint (1-5)
+	ReviewText string     `json:"review"`  // non-null text field
+	ReviewHTML string     `json:"review_html"`
+	ReviewDate time.Time  `json:"review_date"` // timestamp with timezone, default now()
+	EditedAt   *time.Time `json:"edited_at"`
+	Version    int        `json:"version"`
+	// vote tallies of the review
+	HelpfulVotes   int `json:"helpful_votes"`
+	UnhelpfulVotes int `json:"unhelpful_votes"`
+	CommentCount   int `json:"comment_count"`
+}
+
+// RenderText fills in ReviewHTML, like Review.RenderText
+func (r *UserReview) RenderText(hideSpoilers bool) {
+	r.ReviewText, r.ReviewHTML = renderReviewText(r.ReviewText, hideSpoilers)
 }
 
 type UserList struct {
@@ -262,51 +273,41 @@ func (u *UserModel) GetByID(id int64) (*User, error) {
 	return &user, nil
 }
 
-func (u *UserModel) GetUserReviews(userID int64) ([]UserReview, error) {
-	query := `
-	SELECT id, book_id, rating, review, review_date, version
-	FROM bookreviews
-	WHERE user_id = $1
-	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	rows, err := u.DB.QueryContext(ctx, query, userID)
+// GetUserReviews returns a page of the reviews a user wrote of books
+// that are still in the catalog
+func (u *UserModel) GetUserReviews(userID int64, filter ReviewFilter, filters Filters) ([]UserReview, Metadata, error) {
+	found, metadata, err := ReviewModel{DB: u.DB}.list(`user_id = $1
+		AND EXISTS (SELECT 1 FROM books WHERE books.id = bookreviews.book_id AND books.deleted_at IS NULL)`,
+		[]any{userID}, filter, filters)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	defer rows.Close()
 
-	var reviews []UserReview
-	for rows.Next() {
-		var review UserReview
-		err := rows.Scan(
-			&review.ReviewID,
-			&review.BookID,
-			&review.Rating,
-			&review.ReviewText,
-			&review.ReviewDate,
-			&review.Version,
-		)
-		if err != nil {
-			return nil, err
+	reviews := make([]UserReview, len(found))
+	for i, review := range found {
+		reviews[i] = UserReview{
+			ReviewID:   review.ReviewID,
+			BookID:     review.BookID,
+			Rating:     review.Rating,
+			ReviewText: review.ReviewText,
+			ReviewDate: review.ReviewDate,
+			EditedAt:   review.EditedAt,
+			Version:    review.Version,
+
+			HelpfulVotes:   review.HelpfulVotes,
+			UnhelpfulVotes: review.UnhelpfulVotes,
+			CommentCount:   review.CommentCount,
 		}
-		reviews = append(reviews, review)
-	}
-
-	// Check for any errors encountered during iteration
-	if err = rows.Err(); err != nil {
-		return nil, err
 	}
 
-	return reviews, nil
+	return reviews, metadata, nil
 }
 
 func (u *UserModel) GetUserLists(userID int64) ([]UserList, error) {
 	query := `
 	SELECT id, name, description, created_by, version
 	FROM readinglists
-	WHERE created_by = $1
+	WHERE created_by = $1 AND deleted_at IS NULL
 	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
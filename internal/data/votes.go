@@ -0,0 +1,90 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// the votes a member can give a review
+const (
+	VoteHelpful   = 1
+	VoteUnhelpful = -1
+)
+
+// How a review has been voted on
+type VoteTally struct {
+	ReviewID       int64 `json:"review_id"`
+	HelpfulVotes   int   `json:"helpful_votes"`
+	UnhelpfulVotes int   `json:"unhelpful_votes"`
+}
+
+// Vote records the user's vote on a review, replacing the vote they gave
+// it before
+func (c ReviewModel) Vote(reviewID int64, userID int64, vote int) error {
+	query := `
+		INSERT INTO review_votes (review_id, user_id, vote)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (review_id, user_id) DO UPDATE SET vote = EXCLUDED.vote, created_at = NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := c.DB.ExecContext(ctx, query, reviewID, userID, vote)
+	return err
+}
+
+// RemoveVote takes the user's vote on a review back
+func (c ReviewModel) RemoveVote(reviewID int64, userID int64) error {
+	query := `
+		DELETE FROM review_votes
+		WHERE review_id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := c.DB.ExecContext(ctx, query, reviewID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetVotes returns the vote tallies of a review
+func (c ReviewModel) GetVotes(reviewID int64) (*VoteTally, error) {
+	query := `
+		SELECT id, helpful_votes, unhelpful_votes
+		FROM bookreviews
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tally VoteTally
+	err := c.DB.QueryRowContext(ctx, query, reviewID).Scan(
+		&tally.ReviewID,
+		&tally.HelpfulVotes,
+		&tally.UnhelpfulVotes,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &tally, nil
+}
@@ -0,0 +1,310 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrSameWork = errors.New("a work cannot be merged into itself")
+
+// A work groups the editions (rows in books) of the same book so that
+// reviews and ratings can be looked at across all of them
+type Work struct {
+	ID            int64     `json:"id"`
+	Title         string    `json:"title"`
+	Authors       string    `json:"authors"`
+	AverageRating float64   `json:"average_rating"` // across every edition
+	ReviewCount   int       `json:"review_count"`   // across every edition
+	CreatedAt     time.Time `json:"created_at"`
+	Version       int       `json:"version"`
+}
+
+type WorkModel struct {
+	DB *sql.DB
+}
+
+// Get returns a work along with the rating of all of its editions
+func (m WorkModel) Get(id int64) (*Work, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT w.id, w.title, w.authors, w.created_at, w.version,
+		       COALESCE(ROUND(CAST(AVG(r.rating) AS NUMERIC), 2), 0), COUNT(r.id)
+		FROM works w
+		LEFT JOIN books b ON b.work_id = w.id AND b.deleted_at IS NULL
+		LEFT JOIN bookreviews r ON r.book_id = b.id AND r.deleted_at IS NULL AND r.hidden_at IS NULL
+		WHERE w.id = $1
+		GROUP BY w.id
+	`
+	var work Work
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&work.ID,
+		&work.Title,
+		&work.Authors,
+		&work.CreatedAt,
+		&work.Version,
+		&work.AverageRating,
+		&work.ReviewCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &work, nil
+}
+
+// GetEditions returns every book that is an edition of the work
+func (m WorkModel) GetEditions(workID int64) ([]*Book, error) {
+	query := `
+		SELECT id, title, authors, isbn, publication_date, genre, description, average_rating, language, work_id, version
+		FROM books
+		WHERE work_id = $1 AND deleted_at IS NULL
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []*Book{}
+	for rows.Next() {
+		var book Book
+		err := rows.Scan(
+			&book.ID,
+			&book.Title,
+			&book.Authors,
+			&book.ISBN,
+			&book.PublicationDate,
+			&book.Genre,
+			&book.Description,
+			&book.AverageRating,
+			&book.Language,
+			&book.WorkID,
+			&book.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// GetReviews returns the reviews of every edition of the work, newest first
+func (m WorkModel) GetReviews(workID int64) ([]*Review, error) {
+	query := `
+		SELECT r.id, r.book_id, r.user_id, r.rating, r.review, r.review_date, r.version, r.helpful_votes, r.unhelpful_votes, r.helpful_score, r.comment_count, r.edited_at
+		FROM bookreviews r
+		INNER JOIN books b ON b.id = r.book_id
+		WHERE b.work_id = $1 AND b.deleted_at IS NULL AND r.deleted_at IS NULL AND r.hidden_at IS NULL
+		ORDER BY r.review_date DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []*Review{}
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(
+			&review.ReviewID,
+			&review.BookID,
+			&review.UserID,
+			&review.Rating,
+			&review.ReviewText,
+			&review.ReviewDate,
+			&review.Version,
+			&review.HelpfulVotes,
+			&review.UnhelpfulVotes,
+			&review.HelpfulScore,
+			&review.CommentCount,
+			&review.EditedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+// AttachEdition makes the book an edition of the work. The work the
+// book used to belong to is removed if it no longer has any editions
+func (m WorkModel) AttachEdition(workID int64, bookID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM works WHERE id = $1)`, workID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrRecordNotFound
+	}
+
+	var oldWorkID int64
+	query := `
+		UPDATE books b
+		SET work_id = $1
+		FROM books old
+		WHERE b.id = old.id AND b.id = $2 AND b.deleted_at IS NULL
+		RETURNING old.work_id
+	`
+	err = tx.QueryRowContext(ctx, query, workID, bookID).Scan(&oldWorkID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = deleteEmptyWork(ctx, tx, oldWorkID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DetachEdition takes the book out of the work and gives it a new work
+// of its own, built from the book's title and authors
+func (m WorkModel) DetachEdition(workID int64, bookID int64) (*Work, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var work Work
+	query := `
+		INSERT INTO works (title, authors)
+		SELECT title, authors FROM books WHERE id = $1 AND work_id = $2 AND deleted_at IS NULL
+		RETURNING id, title, authors, created_at, version
+	`
+	err = tx.QueryRowContext(ctx, query, bookID, workID).Scan(
+		&work.ID,
+		&work.Title,
+		&work.Authors,
+		&work.CreatedAt,
+		&work.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE books SET work_id = $1 WHERE id = $2`, work.ID, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = deleteEmptyWork(ctx, tx, workID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &work, nil
+}
+
+// Merge moves every edition of the source work into the target work
+// and then removes the source work
+func (m WorkModel) Merge(targetID int64, sourceID int64) error {
+	if targetID == sourceID {
+		return ErrSameWork
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM works WHERE id IN ($1, $2)`, targetID, sourceID).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != 2 {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE books SET work_id = $1 WHERE work_id = $2`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM works WHERE id = $1`, sourceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE works SET version = version + 1 WHERE id = $1`, targetID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteEmptyWork removes a work that no longer has any editions
+func deleteEmptyWork(ctx context.Context, tx *sql.Tx, workID int64) error {
+	query := `
+		DELETE FROM works
+		WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM books WHERE work_id = $1)
+	`
+	_, err := tx.ExecContext(ctx, query, workID)
+	return err
+}
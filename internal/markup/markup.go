@@ -0,0 +1,504 @@
+// Package markup renders the small Markdown subset review texts are
+// written in to HTML that is safe to show as it is.
+//
+// Blocks are separated by blank lines. A block is a paragraph, a quote
+// when every line starts with "> ", or a list when every line starts
+// with "- ". Inside a block there is **bold**, *italic*, `code`,
+// [links](https://example.com) and ||spoilers||. A backslash escapes
+// the character after it. Anything else, HTML included, is shown as
+// text: the only tags in the output are the ones Render writes itself.
+//
+// Render, Validate and RedactSpoilers all read the text with the same
+// parser. Code spans and spoilers are found first, so nothing else can
+// start inside one and end outside it.
+package markup
+
+import (
+	"errors"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Options changes how Render writes the HTML
+type Options struct {
+	HideSpoilers bool // replace the text of every spoiler with SpoilerPlaceholder
+}
+
+// what a hidden spoiler shows instead of its text
+const SpoilerPlaceholder = "[spoiler]"
+
+var (
+	ErrHTML            = errors.New("must not contain HTML tags")
+	ErrUnclosedSpoiler = errors.New("has a spoiler that isn't closed with ||")
+	ErrLinkScheme      = errors.New("may only link to http or https addresses")
+)
+
+var (
+	blockSeparator = regexp.MustCompile(`\n[ \t]*\n\s*`)
+	htmlTag        = regexp.MustCompile(`</?[A-Za-z][A-Za-z0-9-]*(\s[^>]*)?/?>`)
+)
+
+// the characters a backslash escapes
+const escapable = "\\`*_[]()|>-"
+
+// Validate checks that src only uses the markup Render understands. Text
+// that fails it still renders, just not the way its author meant
+func Validate(src string) error {
+	if htmlTag.MatchString(src) {
+		return ErrHTML
+	}
+	for _, b := range parse(normalise(src)) {
+		for _, in := range b.inlines {
+			if _, _, err := parseInline(in.text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Render turns src into HTML
+func Render(src string, opts Options) string {
+	var b strings.Builder
+	for i, blk := range parse(normalise(src)) {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		renderBlock(&b, blk, opts)
+	}
+	return b.String()
+}
+
+// RedactSpoilers replaces the text of every spoiler in src with
+// SpoilerPlaceholder, keeping the rest of the markup as it is
+func RedactSpoilers(src string) string {
+	src = normalise(src)
+
+	var b strings.Builder
+	last := 0
+	for _, blk := range parse(src) {
+		for _, in := range blk.inlines {
+			tokens, _, _ := parseInline(in.text)
+			for _, t := range tokens {
+				if t.kind != tokenSpoiler {
+					continue
+				}
+				start, end := in.pos[t.start], in.pos[t.end-1]+1
+				b.WriteString(src[last:start])
+				b.WriteString(SpoilerPlaceholder)
+				last = end
+			}
+		}
+	}
+	b.WriteString(src[last:])
+	return b.String()
+}
+
+func normalise(src string) string {
+	return strings.ReplaceAll(src, "\r\n", "\n")
+}
+
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockQuote
+	blockList
+)
+
+// A block of src. A list has an inline for each item, the others have one
+type block struct {
+	kind    blockKind
+	inlines []inline
+}
+
+// The text inside a block, with the quote and list markers taken off. pos
+// has where each byte of text is in the source
+type inline struct {
+	text string
+	pos  []int
+}
+
+func (in *inline) add(s string, at int) {
+	in.text += s
+	for i := range len(s) {
+		in.pos = append(in.pos, at+i)
+	}
+}
+
+// parse splits src into blocks on its blank lines
+func parse(src string) []block {
+	var blocks []block
+	last := 0
+	for _, separator := range append(blockSeparator.FindAllStringIndex(src, -1), []int{len(src), len(src)}) {
+		if blk, ok := parseBlock(src, last, separator[0]); ok {
+			blocks = append(blocks, blk)
+		}
+		last = separator[1]
+	}
+	return blocks
+}
+
+// parseBlock reads the block in src[start:end]
+func parseBlock(src string, start int, end int) (block, bool) {
+	for start < end && isSpace(src[start]) {
+		start++
+	}
+	for end > start && isSpace(src[end-1]) {
+		end--
+	}
+	if start == end {
+		return block{}, false
+	}
+
+	type line struct {
+		text string
+		at   int
+	}
+	var lines []line
+	for at := start; at <= end; {
+		n := strings.IndexByte(src[at:end], '\n')
+		if n < 0 {
+			n = end - at
+		}
+		text := src[at : at+n]
+		trimmed := strings.TrimLeft(text, " \t")
+		lines = append(lines, line{text: trimmed, at: at + len(text) - len(trimmed)})
+		at += n + 1
+	}
+
+	every := func(prefix string) bool {
+		for _, l := range lines {
+			if !strings.HasPrefix(l.text, prefix) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case every(">"):
+		var in inline
+		for i, l := range lines {
+			if i > 0 {
+				in.add("\n", l.at-1)
+			}
+			text := strings.TrimPrefix(strings.TrimPrefix(l.text, ">"), " ")
+			in.add(text, l.at+len(l.text)-len(text))
+		}
+		return block{kind: blockQuote, inlines: []inline{in}}, true
+	case every("- "):
+		blk := block{kind: blockList}
+		for _, l := range lines {
+			var in inline
+			in.add(l.text[2:], l.at+2)
+			blk.inlines = append(blk.inlines, in)
+		}
+		return blk, true
+	default:
+		var in inline
+		for i, l := range lines {
+			if i > 0 {
+				in.add("\n", l.at-1)
+			}
+			in.add(l.text, l.at)
+		}
+		return block{kind: blockParagraph, inlines: []inline{in}}, true
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+type tokenKind int
+
+const (
+	tokenText tokenKind = iota
+	tokenCode
+	tokenSpoiler
+	tokenDelimiter
+)
+
+// A piece of the text of a block. A spoiler's text runs from start to
+// end in the string it was read from
+type token struct {
+	kind     tokenKind
+	text     string  // the text with its escapes undone, the code, or the delimiter
+	children []token // what is inside a spoiler
+	start    int
+	end      int
+}
+
+// lexer splits text into tokens. Escapes, code spans and spoilers are
+// settled here, so a delimiter inside one of them is just text
+type lexer struct {
+	s        string
+	unclosed bool // a || had nothing to close it
+}
+
+// lex reads tokens from s[i:] to the end or, inside a spoiler, to the ||
+// that closes it. It returns where it stopped and whether it found the ||
+func (l *lexer) lex(i int, inSpoiler bool) ([]token, int, bool) {
+	var tokens []token
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, token{kind: tokenText, text: text.String()})
+			text.Reset()
+		}
+	}
+	delimiter := func(d string) {
+		flush()
+		tokens = append(tokens, token{kind: tokenDelimiter, text: d})
+		i += len(d)
+	}
+
+	for i < len(l.s) {
+		rest := l.s[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.IndexByte(escapable, rest[1]) >= 0:
+			text.WriteByte(rest[1])
+			i += 2
+		case rest[0] == '`':
+			end := strings.IndexByte(rest[1:], '`')
+			if end <= 0 {
+				text.WriteByte('`')
+				i++
+				continue
+			}
+			flush()
+			tokens = append(tokens, token{kind: tokenCode, text: rest[1 : end+1]})
+			i += end + 2
+		case strings.HasPrefix(rest, "||"):
+			if inSpoiler {
+				flush()
+				return tokens, i + 2, true
+			}
+			// once a || is left open, none after it can close either
+			if l.unclosed {
+				text.WriteString("||")
+				i += 2
+				continue
+			}
+			children, next, closed := l.lex(i+2, true)
+			switch {
+			case !closed:
+				l.unclosed = true
+				text.WriteString("||")
+				i += 2
+			case len(children) == 0:
+				text.WriteString("||||")
+				i = next
+			default:
+				flush()
+				tokens = append(tokens, token{kind: tokenSpoiler, children: children, start: i + 2, end: next - 2})
+				i = next
+			}
+		case strings.HasPrefix(rest, "**"):
+			delimiter("**")
+		case strings.HasPrefix(rest, "]("):
+			delimiter("](")
+		case rest[0] == '*' || rest[0] == '[' || rest[0] == ')':
+			delimiter(rest[:1])
+		default:
+			text.WriteByte(rest[0])
+			i++
+		}
+	}
+	flush()
+	return tokens, i, false
+}
+
+type nodeKind int
+
+const (
+	nodeText nodeKind = iota
+	nodeCode
+	nodeSpoiler
+	nodeStrong
+	nodeEm
+	nodeLink
+)
+
+type node struct {
+	kind     nodeKind
+	text     string // the text, the code, or a link's href
+	children []node
+}
+
+// parseInline reads the text of a block. Along with what Render needs it
+// returns the tokens, for RedactSpoilers, and the first problem Validate
+// should report
+func parseInline(s string) ([]token, []node, error) {
+	l := lexer{s: s}
+	tokens, _, _ := l.lex(0, false)
+
+	var p parser
+	nodes := p.nodes(tokens)
+	if p.err == nil && l.unclosed {
+		p.err = ErrUnclosedSpoiler
+	}
+	return tokens, nodes, p.err
+}
+
+// parser pairs up the delimiters in a list of tokens. Only delimiters in
+// the same list pair up, so emphasis and links never cross a spoiler
+type parser struct {
+	err error
+}
+
+// nodes turns tokens into nodes. A delimiter without its closing half is
+// just text
+func (p *parser) nodes(tokens []token) []node {
+	var nodes []node
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch t.kind {
+		case tokenText:
+			nodes = append(nodes, node{kind: nodeText, text: t.text})
+		case tokenCode:
+			nodes = append(nodes, node{kind: nodeCode, text: t.text})
+		case tokenSpoiler:
+			nodes = append(nodes, node{kind: nodeSpoiler, children: p.nodes(t.children)})
+		case tokenDelimiter:
+			switch t.text {
+			case "**", "*":
+				if end := closing(tokens, i+1, t.text); end > i+1 {
+					kind := nodeEm
+					if t.text == "**" {
+						kind = nodeStrong
+					}
+					nodes = append(nodes, node{kind: kind, children: p.nodes(tokens[i+1 : end])})
+					i = end
+					continue
+				}
+			case "[":
+				if link, end, ok := p.link(tokens, i); ok {
+					nodes = append(nodes, link)
+					i = end
+					continue
+				}
+			}
+			nodes = append(nodes, node{kind: nodeText, text: t.text})
+		}
+	}
+	return nodes
+}
+
+// closing finds the next delimiter d in tokens from i on, -1 when there
+// is none
+func closing(tokens []token, i int, d string) int {
+	for ; i < len(tokens); i++ {
+		if tokens[i].kind == tokenDelimiter && tokens[i].text == d {
+			return i
+		}
+	}
+	return -1
+}
+
+// link reads a [text](href) link starting at tokens[i], returning it and
+// the index of its closing parenthesis. A link to anywhere but an http or
+// https address is left as text and noted for Validate
+func (p *parser) link(tokens []token, i int) (node, int, bool) {
+	middle := closing(tokens, i+1, "](")
+	if middle < 0 {
+		return node{}, 0, false
+	}
+	for _, t := range tokens[i+1 : middle] {
+		if t.kind == tokenText && strings.Contains(t.text, "\n") {
+			return node{}, 0, false
+		}
+	}
+	end := closing(tokens, middle+1, ")")
+	if end < 0 {
+		return node{}, 0, false
+	}
+
+	var href strings.Builder
+	for _, t := range tokens[middle+1 : end] {
+		if t.kind != tokenText || strings.ContainsAny(t.text, " \t\n") {
+			return node{}, 0, false
+		}
+		href.WriteString(t.text)
+	}
+	if !safeURL(href.String()) {
+		if p.err == nil {
+			p.err = ErrLinkScheme
+		}
+		return node{}, 0, false
+	}
+	if middle == i+1 {
+		return node{}, 0, false
+	}
+	return node{kind: nodeLink, text: href.String(), children: p.nodes(tokens[i+1 : middle])}, end, true
+}
+
+func renderBlock(b *strings.Builder, blk block, opts Options) {
+	switch blk.kind {
+	case blockQuote:
+		b.WriteString("<blockquote><p>")
+		renderInline(b, blk.inlines[0], opts)
+		b.WriteString("</p></blockquote>")
+	case blockList:
+		b.WriteString("<ul>")
+		for _, in := range blk.inlines {
+			b.WriteString("<li>")
+			renderInline(b, in, opts)
+			b.WriteString("</li>")
+		}
+		b.WriteString("</ul>")
+	default:
+		b.WriteString("<p>")
+		renderInline(b, blk.inlines[0], opts)
+		b.WriteString("</p>")
+	}
+}
+
+func renderInline(b *strings.Builder, in inline, opts Options) {
+	_, nodes, _ := parseInline(in.text)
+	renderNodes(b, nodes, opts)
+}
+
+func renderNodes(b *strings.Builder, nodes []node, opts Options) {
+	for _, n := range nodes {
+		switch n.kind {
+		case nodeText:
+			b.WriteString(strings.ReplaceAll(html.EscapeString(n.text), "\n", "<br>\n"))
+		case nodeCode:
+			b.WriteString("<code>")
+			b.WriteString(html.EscapeString(n.text))
+			b.WriteString("</code>")
+		case nodeSpoiler:
+			if opts.HideSpoilers {
+				b.WriteString(`<span class="spoiler spoiler-hidden">` + html.EscapeString(SpoilerPlaceholder) + `</span>`)
+			} else {
+				b.WriteString(`<span class="spoiler">`)
+				renderNodes(b, n.children, opts)
+				b.WriteString("</span>")
+			}
+		case nodeStrong:
+			b.WriteString("<strong>")
+			renderNodes(b, n.children, opts)
+			b.WriteString("</strong>")
+		case nodeEm:
+			b.WriteString("<em>")
+			renderNodes(b, n.children, opts)
+			b.WriteString("</em>")
+		case nodeLink:
+			b.WriteString(`<a href="` + html.EscapeString(n.text) + `" rel="nofollow ugc">`)
+			renderNodes(b, n.children, opts)
+			b.WriteString("</a>")
+		}
+	}
+}
+
+func safeURL(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
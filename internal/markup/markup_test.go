@@ -0,0 +1,88 @@
+package markup
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		src    string
+		shown  string
+		hidden string
+	}{
+		{"plain text", "<p>plain text</p>", "<p>plain text</p>"},
+		{"**bold** and *italic*", "<p><strong>bold</strong> and <em>italic</em></p>", "<p><strong>bold</strong> and <em>italic</em></p>"},
+		{"<b>not a tag</b>", "<p>&lt;b&gt;not a tag&lt;/b&gt;</p>", "<p>&lt;b&gt;not a tag&lt;/b&gt;</p>"},
+		{"a ||secret|| b", `<p>a <span class="spoiler">secret</span> b</p>`, `<p>a <span class="spoiler spoiler-hidden">[spoiler]</span> b</p>`},
+		{"||**bold** secret||", `<p><span class="spoiler"><strong>bold</strong> secret</span></p>`, `<p><span class="spoiler spoiler-hidden">[spoiler]</span></p>`},
+		// emphasis can't start outside a spoiler and end inside it
+		{"*a||b* c||", `<p>*a<span class="spoiler">b* c</span></p>`, `<p>*a<span class="spoiler spoiler-hidden">[spoiler]</span></p>`},
+		{"||a *b|| c*", `<p><span class="spoiler">a *b</span> c*</p>`, `<p><span class="spoiler spoiler-hidden">[spoiler]</span> c*</p>`},
+		// a || in a code span or escaped doesn't open a spoiler
+		{"`||` a ||s||", `<p><code>||</code> a <span class="spoiler">s</span></p>`, `<p><code>||</code> a <span class="spoiler spoiler-hidden">[spoiler]</span></p>`},
+		{`\|| a ||s||`, `<p>|| a <span class="spoiler">s</span></p>`, `<p>|| a <span class="spoiler spoiler-hidden">[spoiler]</span></p>`},
+		{"||a `||` b||", `<p><span class="spoiler">a <code>||</code> b</span></p>`, `<p><span class="spoiler spoiler-hidden">[spoiler]</span></p>`},
+		{"[a ||b](https://example.com) c||", `<p>[a <span class="spoiler">b](https://example.com) c</span></p>`, `<p>[a <span class="spoiler spoiler-hidden">[spoiler]</span></p>`},
+		{"[site](https://example.com)", `<p><a href="https://example.com" rel="nofollow ugc">site</a></p>`, `<p><a href="https://example.com" rel="nofollow ugc">site</a></p>`},
+		{"[site](javascript:alert(1))", "<p>[site](javascript:alert(1))</p>", "<p>[site](javascript:alert(1))</p>"},
+		{"> quoted ||x\n> y||", `<blockquote><p>quoted <span class="spoiler">x<br>
+y</span></p></blockquote>`, `<blockquote><p>quoted <span class="spoiler spoiler-hidden">[spoiler]</span></p></blockquote>`},
+		// a spoiler can't run from one list item into the next
+		{"- a ||x\n- y|| b", "<ul><li>a ||x</li><li>y|| b</li></ul>", "<ul><li>a ||x</li><li>y|| b</li></ul>"},
+		{"one\n\n\ntwo", "<p>one</p>\n<p>two</p>", "<p>one</p>\n<p>two</p>"},
+	}
+
+	for _, tt := range tests {
+		if got := Render(tt.src, Options{}); got != tt.shown {
+			t.Errorf("Render(%q) = %q, want %q", tt.src, got, tt.shown)
+		}
+		if got := Render(tt.src, Options{HideSpoilers: true}); got != tt.hidden {
+			t.Errorf("Render(%q, HideSpoilers) = %q, want %q", tt.src, got, tt.hidden)
+		}
+	}
+}
+
+func TestRedactSpoilers(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"no spoilers", "no spoilers"},
+		{"a ||secret|| b ||more||", "a ||[spoiler]|| b ||[spoiler]||"},
+		{"*a||b* c||", "*a||[spoiler]||"},
+		{"`||` a ||s||", "`||` a ||[spoiler]||"},
+		{`\|| a ||s||`, `\|| a ||[spoiler]||`},
+		{"||a `||` b||", "||[spoiler]||"},
+		{"one ||x||\r\n\r\n> two ||y\n> z||", "one ||[spoiler]||\n\n> two ||[spoiler]||"},
+		{"- a ||x\n- y|| b", "- a ||x\n- y|| b"},
+	}
+
+	for _, tt := range tests {
+		if got := RedactSpoilers(tt.src); got != tt.want {
+			t.Errorf("RedactSpoilers(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		src  string
+		want error
+	}{
+		{"**fine** ||spoiler|| [link](https://example.com)", nil},
+		{"*a||b* c||", nil},
+		{"`||` a ||s||", nil},
+		{"a `||` b", nil},
+		{`a \|| b`, nil},
+		{"<script>alert(1)</script>", ErrHTML},
+		{"a ||b", ErrUnclosedSpoiler},
+		{"||a\n\nb||", ErrUnclosedSpoiler},
+		{"- a ||x\n- y|| b", ErrUnclosedSpoiler},
+		{"[x](javascript:alert(1))", ErrLinkScheme},
+		{"||[x](ftp://example.com)||", ErrLinkScheme},
+	}
+
+	for _, tt := range tests {
+		if got := Validate(tt.src); got != tt.want {
+			t.Errorf("Validate(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
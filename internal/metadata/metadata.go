@@ -0,0 +1,71 @@
+// Filename: internal/metadata/metadata.go
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("no metadata found for this isbn")
+
+// Record is what a provider knows about one edition of a book. The
+// fields line up with data.Book so a record can be used to prefill one
+type Record struct {
+	ISBN            string `json:"isbn"`
+	Title           string `json:"title"`
+	Authors         string `json:"authors"`
+	PublicationDate string `json:"publication_date"`
+	Genre           string `json:"genre"`
+	Description     string `json:"description"`
+}
+
+// A Provider looks up book metadata by ISBN
+type Provider interface {
+	Name() string
+	LookupISBN(ctx context.Context, isbn string) (*Record, error)
+}
+
+// Cache stores the raw records a provider returned so that we do not
+// ask the provider about the same ISBN over and over. Get returns an
+// error when it has nothing stored that is younger than maxAge
+type Cache interface {
+	Get(isbn string, provider string, maxAge time.Duration) ([]byte, error)
+	Put(isbn string, provider string, payload []byte) error
+}
+
+// Cached wraps a provider with a cache. Cache failures are not fatal,
+// the lookup just goes through to the provider
+type Cached struct {
+	Provider Provider
+	Cache    Cache
+	MaxAge   time.Duration
+}
+
+func (c Cached) Name() string {
+	return c.Provider.Name()
+}
+
+func (c Cached) LookupISBN(ctx context.Context, isbn string) (*Record, error) {
+	payload, err := c.Cache.Get(isbn, c.Provider.Name(), c.MaxAge)
+	if err == nil {
+		var record Record
+		if json.Unmarshal(payload, &record) == nil {
+			return &record, nil
+		}
+	}
+
+	record, err := c.Provider.LookupISBN(ctx, isbn)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err = json.Marshal(record)
+	if err == nil {
+		// a failed write only means we ask the provider again next time
+		_ = c.Cache.Put(isbn, c.Provider.Name(), payload)
+	}
+
+	return record, nil
+}
@@ -0,0 +1,123 @@
+// Filename: internal/metadata/openlibrary.go
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OpenLibrary talks to the Open Library books API, or anything that
+// answers the same way. BaseURL is configurable so a stub server can
+// stand in for the real thing
+type OpenLibrary struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewOpenLibrary(baseURL string, timeout time.Duration) OpenLibrary {
+	return OpenLibrary{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (o OpenLibrary) Name() string {
+	return "openlibrary"
+}
+
+// the parts of a jscmd=data response that we use
+type openLibraryBook struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+	Authors  []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	PublishDate string `json:"publish_date"`
+	Subjects    []struct {
+		Name string `json:"name"`
+	} `json:"subjects"`
+	Notes    json.RawMessage `json:"notes"`
+	Excerpts []struct {
+		Text string `json:"text"`
+	} `json:"excerpts"`
+}
+
+func (o OpenLibrary) LookupISBN(ctx context.Context, isbn string) (*Record, error) {
+	key := "ISBN:" + isbn
+
+	query := url.Values{}
+	query.Set("bibkeys", key)
+	query.Set("format", "json")
+	query.Set("jscmd", "data")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.BaseURL+"/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := o.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("open library returned status %d", res.StatusCode)
+	}
+
+	var books map[string]openLibraryBook
+	err = json.NewDecoder(res.Body).Decode(&books)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode open library response: %w", err)
+	}
+
+	book, found := books[key]
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	record := &Record{
+		ISBN:            isbn,
+		Title:           book.Title,
+		PublicationDate: book.PublishDate,
+	}
+	if book.Subtitle != "" {
+		record.Title += ": " + book.Subtitle
+	}
+
+	authors := make([]string, 0, len(book.Authors))
+	for _, author := range book.Authors {
+		authors = append(authors, author.Name)
+	}
+	record.Authors = strings.Join(authors, ", ")
+
+	if len(book.Subjects) > 0 {
+		record.Genre = book.Subjects[0].Name
+	}
+
+	// notes is either a plain string or a {"type", "value"} object
+	var notes string
+	if json.Unmarshal(book.Notes, &notes) != nil {
+		var typed struct {
+			Value string `json:"value"`
+		}
+		if json.Unmarshal(book.Notes, &typed) == nil {
+			notes = typed.Value
+		}
+	}
+	record.Description = strings.TrimSpace(notes)
+	if record.Description == "" && len(book.Excerpts) > 0 {
+		record.Description = strings.TrimSpace(book.Excerpts[0].Text)
+	}
+
+	return record, nil
+}
@@ -0,0 +1,85 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOpenLibraryLookupISBN(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/books" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("format") != "json" || query.Get("jscmd") != "data" {
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+
+		switch query.Get("bibkeys") {
+		case "ISBN:9780439023481":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ISBN:9780439023481": {
+				"title": "The Hunger Games",
+				"subtitle": "Book One",
+				"authors": [{"name": "Suzanne Collins"}, {"name": "A. N. Other"}],
+				"publish_date": "2008",
+				"subjects": [{"name": "Dystopian fiction"}, {"name": "Survival"}],
+				"notes": {"type": "/type/text", "value": " A story of survival. "}
+			}}`))
+		case "ISBN:9780000000002":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		case "ISBN:9780000000019":
+			http.Error(w, "upstream failure", http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	provider := NewOpenLibrary(ts.URL+"/", 2*time.Second)
+
+	t.Run("found", func(t *testing.T) {
+		record, err := provider.LookupISBN(context.Background(), "9780439023481")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := Record{
+			ISBN:            "9780439023481",
+			Title:           "The Hunger Games: Book One",
+			Authors:         "Suzanne Collins, A. N. Other",
+			PublicationDate: "2008",
+			Genre:           "Dystopian fiction",
+			Description:     "A story of survival.",
+		}
+		if *record != want {
+			t.Errorf("got %+v, want %+v", *record, want)
+		}
+	})
+
+	t.Run("not in the response", func(t *testing.T) {
+		_, err := provider.LookupISBN(context.Background(), "9780000000002")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("404", func(t *testing.T) {
+		_, err := provider.LookupISBN(context.Background(), "9780000000026")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		_, err := provider.LookupISBN(context.Background(), "9780000000019")
+		if err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v, want a status error", err)
+		}
+	})
+}
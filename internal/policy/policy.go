@@ -0,0 +1,187 @@
+// Filename: internal/policy/policy.go
+
+// Package policy decides whether user written text is fit for the club:
+// no blocked words, nothing matching the configured rules, not too many
+// links and none to blocked domains.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+// Config is the content policy as it is written in the policy file
+type Config struct {
+	BlockedWords   []string `json:"blocked_words"`   // words and phrases, matched whole and ignoring case
+	BlockedDomains []string `json:"blocked_domains"` // links to these domains or their subdomains
+	Rules          []Rule   `json:"rules"`
+	MaxURLs        int      `json:"max_urls"` // 0 for no limit
+}
+
+// A Rule rejects text matching a regular expression. Message is what
+// the user is told, a generic one is used when it is empty
+type Rule struct {
+	Pattern string `json:"pattern"`
+	Message string `json:"message"`
+}
+
+// A Policy is a compiled Config. The zero value allows everything, as
+// does a nil *Policy
+type Policy struct {
+	words   *regexp.Regexp
+	domains []string
+	rules   []rule
+	maxURLs int
+	summary Summary
+}
+
+type rule struct {
+	pattern *regexp.Regexp
+	message string
+}
+
+// Summary describes a policy without giving its word lists away
+type Summary struct {
+	BlockedWords   int `json:"blocked_words"`
+	BlockedDomains int `json:"blocked_domains"`
+	Rules          int `json:"rules"`
+	MaxURLs        int `json:"max_urls"`
+}
+
+// links in text, with or without a scheme
+var linkRX = regexp.MustCompile(`(?i)(?:https?://|www\.)[^\s<>()\[\]"']+`)
+
+// New compiles a policy from its config
+func New(cfg Config) (*Policy, error) {
+	if cfg.MaxURLs < 0 {
+		return nil, fmt.Errorf("max_urls must not be negative")
+	}
+	p := &Policy{maxURLs: cfg.MaxURLs}
+
+	words := []string{}
+	for _, word := range cfg.BlockedWords {
+		word = strings.TrimSpace(word)
+		if word != "" {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+	}
+	if len(words) > 0 {
+		// \b only knows ASCII, so word boundaries are spelled out
+		p.words = regexp.MustCompile(`(?i)(?:^|[^\pL\pN])(?:` + strings.Join(words, "|") + `)(?:$|[^\pL\pN])`)
+	}
+
+	for _, domain := range cfg.BlockedDomains {
+		domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+		if domain != "" {
+			p.domains = append(p.domains, domain)
+		}
+	}
+
+	for i, r := range cfg.Rules {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		message := r.Message
+		if message == "" {
+			message = "contains text that isn't allowed"
+		}
+		p.rules = append(p.rules, rule{pattern: pattern, message: message})
+	}
+
+	p.summary = Summary{
+		BlockedWords:   len(words),
+		BlockedDomains: len(p.domains),
+		Rules:          len(p.rules),
+		MaxURLs:        p.maxURLs,
+	}
+	return p, nil
+}
+
+// Load reads and compiles the policy file at path
+func Load(path string) (*Policy, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Check adds an error for field to v if text breaks the policy. Only the
+// first problem is reported
+func (p *Policy) Check(v *validator.Validator, field string, text string) {
+	if p == nil || text == "" {
+		return
+	}
+
+	if p.words != nil && p.words.MatchString(text) {
+		v.AddError(field, "contains language that isn't allowed")
+		return
+	}
+
+	for _, r := range p.rules {
+		if r.pattern.MatchString(text) {
+			v.AddError(field, r.message)
+			return
+		}
+	}
+
+	links := linkRX.FindAllString(text, -1)
+	if p.maxURLs > 0 && len(links) > p.maxURLs {
+		v.AddError(field, fmt.Sprintf("must not contain more than %d links", p.maxURLs))
+		return
+	}
+	for _, link := range links {
+		if domain, blocked := p.blockedDomain(link); blocked {
+			v.AddError(field, fmt.Sprintf("must not link to %s", domain))
+			return
+		}
+	}
+}
+
+// blockedDomain reports whether link goes to a blocked domain, and which
+func (p *Policy) blockedDomain(link string) (string, bool) {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range p.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return domain, true
+		}
+	}
+	return "", false
+}
+
+// Summary counts what the policy checks for
+func (p *Policy) Summary() Summary {
+	if p == nil {
+		return Summary{}
+	}
+	return p.summary
+}
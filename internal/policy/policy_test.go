@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/mtechguy/test3/internal/validator"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"empty", Config{}, false},
+		{"full", Config{BlockedWords: []string{"spam", " "}, BlockedDomains: []string{".Example.com."}, Rules: []Rule{{Pattern: `\d{16}`}}, MaxURLs: 2}, false},
+		{"negative max_urls", Config{MaxURLs: -1}, true},
+		{"bad rule", Config{Rules: []Rule{{Pattern: `(`}}}, true},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.cfg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("New(%s) error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p, err := New(Config{
+		BlockedWords:   []string{"spam", "bad word", "ärger"},
+		BlockedDomains: []string{"Evil.com"},
+		Rules: []Rule{
+			{Pattern: `\b\d{4}[ -]?\d{4}[ -]?\d{4}[ -]?\d{4}\b`, Message: "must not contain card numbers"},
+			{Pattern: `(?i)buy now`},
+		},
+		MaxURLs: 2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"a perfectly fine review", ""},
+		{"", ""},
+		// blocked words match whole words, ignoring case, in any script
+		{"this is SPAM", "contains language that isn't allowed"},
+		{"spam.", "contains language that isn't allowed"},
+		{"spammer and antispam", ""},
+		{"a Bad Word here", "contains language that isn't allowed"},
+		{"badword", ""},
+		{"viel Ärger heute", "contains language that isn't allowed"},
+		{"verärgert", ""},
+		{"ärgerlich", ""},
+		// rules
+		{"card 1234 5678 9012 3456", "must not contain card numbers"},
+		{"Buy Now!", "contains text that isn't allowed"},
+		// links
+		{"see https://example.com and www.example.org", ""},
+		{"a.com http://b.com https://c.com www.d.com", "must not contain more than 2 links"},
+		{"go to https://evil.com/page", "must not link to evil.com"},
+		{"go to www.shop.EVIL.com", "must not link to evil.com"},
+		{"go to https://notevil.com", ""},
+		{"go to https://evil.com.example.org", ""},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		p.Check(v, "text", tt.text)
+		if got := v.Errors["text"]; got != tt.want {
+			t.Errorf("Check(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCheckNilPolicy(t *testing.T) {
+	var p *Policy
+	v := validator.New()
+	p.Check(v, "text", "spam https://evil.com")
+	if !v.IsEmpty() {
+		t.Errorf("nil policy reported %v", v.Errors)
+	}
+	if p.Summary() != (Summary{}) {
+		t.Errorf("nil policy summary = %+v", p.Summary())
+	}
+}
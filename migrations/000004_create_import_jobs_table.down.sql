@@ -0,0 +1,6 @@
+DELETE FROM readinglist_books WHERE status = 'want to read';
+ALTER TABLE readinglist_books DROP CONSTRAINT IF EXISTS readinglist_books_status_check;
+ALTER TABLE readinglist_books ADD CONSTRAINT readinglist_books_status_check
+    CHECK (status IN ('currently reading', 'completed'));
+
+DROP TABLE IF EXISTS import_jobs;
@@ -0,0 +1,23 @@
+-- Background imports (e.g. a Goodreads library export) and their progress
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    source text NOT NULL,
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    total_rows integer NOT NULL DEFAULT 0,
+    processed_rows integer NOT NULL DEFAULT 0,
+    books_created integer NOT NULL DEFAULT 0,
+    books_matched integer NOT NULL DEFAULT 0,
+    list_entries integer NOT NULL DEFAULT 0,
+    reviews_created integer NOT NULL DEFAULT 0,
+    errors jsonb NOT NULL DEFAULT '[]',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS import_jobs_user_id_idx ON import_jobs (user_id);
+
+-- Goodreads has a "to-read" shelf, so reading lists need a status for it
+ALTER TABLE readinglist_books DROP CONSTRAINT IF EXISTS readinglist_books_status_check;
+ALTER TABLE readinglist_books ADD CONSTRAINT readinglist_books_status_check
+    CHECK (status IN ('want to read', 'currently reading', 'completed'));
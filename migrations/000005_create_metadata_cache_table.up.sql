@@ -0,0 +1,8 @@
+-- Book metadata fetched from an external provider, keyed by ISBN
+CREATE TABLE IF NOT EXISTS metadata_cache (
+    isbn VARCHAR(20) NOT NULL,
+    provider text NOT NULL,
+    payload jsonb NOT NULL,
+    fetched_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (isbn, provider)
+);
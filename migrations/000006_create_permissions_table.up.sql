@@ -0,0 +1,16 @@
+-- Permissions for the admin parts of the API. Grant one to a user with
+-- INSERT INTO users_permissions SELECT <user id>, id FROM permissions WHERE code = '<code>';
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('books:admin')
+ON CONFLICT (code) DO NOTHING;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS assign_book_work ON books;
+DROP FUNCTION IF EXISTS assign_book_work();
+ALTER TABLE books DROP COLUMN IF EXISTS work_id;
+DROP TABLE IF EXISTS works;
@@ -0,0 +1,45 @@
+-- A work is the book as written. Every row in books is one edition
+-- (hardback, paperback, translation...) of a work
+CREATE TABLE IF NOT EXISTS works (
+    id bigserial PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    authors TEXT,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS work_id bigint REFERENCES works(id);
+
+-- every existing book starts out as the only edition of its own work
+DO $$
+DECLARE
+    b RECORD;
+    wid bigint;
+BEGIN
+    FOR b IN SELECT id, title, authors FROM books WHERE work_id IS NULL LOOP
+        INSERT INTO works (title, authors) VALUES (b.title, b.authors) RETURNING id INTO wid;
+        UPDATE books SET work_id = wid WHERE id = b.id;
+    END LOOP;
+END $$;
+
+ALTER TABLE books ALTER COLUMN work_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS books_work_id_idx ON books (work_id);
+
+-- New books get a work of their own unless one is given
+CREATE OR REPLACE FUNCTION assign_book_work()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.work_id IS NULL THEN
+        INSERT INTO works (title, authors)
+        VALUES (NEW.title, NEW.authors)
+        RETURNING id INTO NEW.work_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER assign_book_work
+BEFORE INSERT ON books
+FOR EACH ROW
+EXECUTE FUNCTION assign_book_work();
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS series (
+    id bigserial PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+-- A book's place in a series. Position is fractional so that novellas
+-- can sit between the main books (2.5 comes after 2 and before 3)
+CREATE TABLE IF NOT EXISTS series_books (
+    series_id bigint NOT NULL REFERENCES series(id) ON DELETE CASCADE,
+    book_id bigint NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    position NUMERIC(6, 2) NOT NULL CHECK (position > 0),
+    PRIMARY KEY (series_id, book_id)
+);
+
+CREATE INDEX IF NOT EXISTS series_books_book_id_idx ON series_books (book_id);
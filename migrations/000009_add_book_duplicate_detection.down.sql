@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS books_title_trgm_idx;
+DROP INDEX IF EXISTS books_normalized_isbn_idx;
+DROP FUNCTION IF EXISTS author_overlap(text, text);
+DROP FUNCTION IF EXISTS normalize_isbn(text);
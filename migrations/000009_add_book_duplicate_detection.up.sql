@@ -0,0 +1,32 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- An ISBN with the hyphens and spaces taken out
+CREATE OR REPLACE FUNCTION normalize_isbn(isbn text)
+RETURNS text AS $$
+    SELECT upper(regexp_replace(COALESCE(isbn, ''), '[^0-9Xx]', '', 'g'));
+$$ LANGUAGE sql IMMUTABLE;
+
+-- How much two comma separated author lists have in common, from 0
+-- (nobody in common) to 1 (the same people)
+CREATE OR REPLACE FUNCTION author_overlap(a text, b text)
+RETURNS double precision AS $$
+    WITH x AS (
+        SELECT DISTINCT trim(lower(name)) AS name
+        FROM unnest(string_to_array(COALESCE(a, ''), ',')) AS name
+        WHERE trim(name) <> ''
+    ), y AS (
+        SELECT DISTINCT trim(lower(name)) AS name
+        FROM unnest(string_to_array(COALESCE(b, ''), ',')) AS name
+        WHERE trim(name) <> ''
+    ), everyone AS (
+        SELECT name FROM x UNION SELECT name FROM y
+    )
+    SELECT CASE
+        WHEN (SELECT COUNT(*) FROM everyone) = 0 THEN 0
+        ELSE (SELECT COUNT(*) FROM x INNER JOIN y USING (name))::double precision
+             / (SELECT COUNT(*) FROM everyone)
+    END;
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS books_normalized_isbn_idx ON books (normalize_isbn(isbn));
+CREATE INDEX IF NOT EXISTS books_title_trgm_idx ON books USING GIN (lower(title) gin_trgm_ops);
@@ -0,0 +1,23 @@
+CREATE OR REPLACE FUNCTION automatic_average_rating()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Update the average rating of the book associated with the new review
+    UPDATE books
+    SET average_rating = (
+        SELECT ROUND(CAST(AVG(rating) AS NUMERIC), 2)
+        FROM bookreviews
+        WHERE bookreviews.book_id = NEW.book_id
+    )
+    WHERE id = NEW.book_id;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS bookreviews_deleted_at_idx;
+DROP INDEX IF EXISTS readinglists_deleted_at_idx;
+DROP INDEX IF EXISTS books_deleted_at_idx;
+
+ALTER TABLE bookreviews DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE readinglists DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE books DROP COLUMN IF EXISTS deleted_at;
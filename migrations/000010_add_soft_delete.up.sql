@@ -0,0 +1,26 @@
+-- Deleting a book, list or review only marks it as deleted. The rows are
+-- removed for good by the trash purge once the retention period is over
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) WITH TIME ZONE;
+ALTER TABLE readinglists ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) WITH TIME ZONE;
+ALTER TABLE bookreviews ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS books_deleted_at_idx ON books (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS readinglists_deleted_at_idx ON readinglists (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS bookreviews_deleted_at_idx ON bookreviews (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Deleted reviews no longer count towards the average rating, and a book
+-- whose last review was deleted goes back to 0
+CREATE OR REPLACE FUNCTION automatic_average_rating()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE books
+    SET average_rating = COALESCE((
+        SELECT ROUND(CAST(AVG(rating) AS NUMERIC), 2)
+        FROM bookreviews
+        WHERE bookreviews.book_id = NEW.book_id AND bookreviews.deleted_at IS NULL
+    ), 0)
+    WHERE id = NEW.book_id;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
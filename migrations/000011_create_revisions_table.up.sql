@@ -0,0 +1,15 @@
+-- Every insert, update and delete made to a book, reading list or review.
+-- snapshot holds the whole record as it was after the change (or just
+-- before it, for a delete) and diff holds only the fields that changed
+CREATE TABLE IF NOT EXISTS revisions (
+    id bigserial PRIMARY KEY,
+    entity_type text NOT NULL CHECK (entity_type IN ('book', 'list', 'review')),
+    entity_id bigint NOT NULL,
+    action text NOT NULL CHECK (action IN ('insert', 'update', 'delete', 'restore', 'revert')),
+    actor_id bigint REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    diff jsonb NOT NULL DEFAULT '{}',
+    snapshot jsonb NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revisions_entity_idx ON revisions (entity_type, entity_id, id DESC);
@@ -0,0 +1,16 @@
+-- The text search configuration a book is stemmed with
+ALTER TABLE books ADD COLUMN IF NOT EXISTS language regconfig NOT NULL DEFAULT 'english';
+
+-- Titles and authors count most, then the genre, then the description.
+-- Authors and genres are names, so they are not stemmed
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector(language, COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(authors, '')), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(genre, '')), 'B') ||
+    setweight(to_tsvector(language, COALESCE(description, '')), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS books_search_vector_idx ON books USING GIN (search_vector);
+
+-- lower(title) already has a trigram index for the duplicate finder
+CREATE INDEX IF NOT EXISTS books_authors_trgm_idx ON books USING GIN (lower(authors) gin_trgm_ops);
@@ -0,0 +1,33 @@
+-- Completions for the search box. A book's popularity is how many reviews
+-- it has plus how many reading lists it is on, and a term is as popular
+-- as all of the books it belongs to. The view is refreshed by the API on
+-- a timer, so suggestions can lag a few minutes behind the catalog
+CREATE MATERIALIZED VIEW IF NOT EXISTS search_suggestions AS
+WITH book_popularity AS (
+    SELECT b.id, b.title, b.authors, b.genre,
+           (SELECT COUNT(*) FROM bookreviews r
+            WHERE r.book_id = b.id AND r.deleted_at IS NULL)
+           + (SELECT COUNT(*) FROM readinglist_books rb
+              INNER JOIN readinglists l ON l.id = rb.readinglist_id
+              WHERE rb.book_id = b.id AND l.deleted_at IS NULL) AS popularity
+    FROM books b
+    WHERE b.deleted_at IS NULL
+), terms AS (
+    SELECT 'title' AS kind, trim(title) AS term, popularity FROM book_popularity
+    UNION ALL
+    SELECT 'author', trim(name), popularity
+    FROM book_popularity, unnest(string_to_array(authors, ',')) AS name
+    UNION ALL
+    SELECT 'genre', trim(genre), popularity FROM book_popularity
+)
+SELECT kind, lower(term) AS key, min(term) AS term, SUM(popularity)::bigint AS popularity
+FROM terms
+WHERE term <> ''
+GROUP BY kind, lower(term);
+
+-- needed to refresh the view concurrently
+CREATE UNIQUE INDEX IF NOT EXISTS search_suggestions_kind_key_idx ON search_suggestions (kind, key);
+-- "hob" -> "hobbit, the"
+CREATE INDEX IF NOT EXISTS search_suggestions_prefix_idx ON search_suggestions (key text_pattern_ops);
+-- "hob" -> "the hobbit"
+CREATE INDEX IF NOT EXISTS search_suggestions_trgm_idx ON search_suggestions USING GIN (key gin_trgm_ops);
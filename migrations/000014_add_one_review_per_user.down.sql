@@ -0,0 +1 @@
+DROP INDEX IF EXISTS bookreviews_book_user_key;
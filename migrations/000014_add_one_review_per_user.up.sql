@@ -0,0 +1,20 @@
+-- A user gets one review per book. Where somebody already reviewed a
+-- book more than once the newest review is kept and the rest go to the
+-- trash
+UPDATE bookreviews
+SET deleted_at = NOW(), version = version + 1
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, row_number() OVER (
+            PARTITION BY book_id, user_id ORDER BY review_date DESC, id DESC
+        ) AS n
+        FROM bookreviews
+        WHERE deleted_at IS NULL AND user_id IS NOT NULL
+    ) ranked
+    WHERE n > 1
+);
+
+-- deleted reviews don't count, so a user can review a book again after
+-- deleting their review
+CREATE UNIQUE INDEX IF NOT EXISTS bookreviews_book_user_key
+    ON bookreviews (book_id, user_id) WHERE deleted_at IS NULL;
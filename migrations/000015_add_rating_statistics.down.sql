@@ -0,0 +1,19 @@
+CREATE OR REPLACE FUNCTION automatic_average_rating()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE books
+    SET average_rating = COALESCE((
+        SELECT ROUND(CAST(AVG(rating) AS NUMERIC), 2)
+        FROM bookreviews
+        WHERE bookreviews.book_id = NEW.book_id AND bookreviews.deleted_at IS NULL
+    ), 0)
+    WHERE id = NEW.book_id;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS refresh_book_rating(bigint);
+
+ALTER TABLE books DROP COLUMN IF EXISTS rating_counts;
+ALTER TABLE books DROP COLUMN IF EXISTS review_count;
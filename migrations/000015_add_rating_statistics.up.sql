@@ -0,0 +1,53 @@
+-- How many reviews a book has and how many of them gave it 1 to 5 stars
+ALTER TABLE books ADD COLUMN IF NOT EXISTS review_count integer NOT NULL DEFAULT 0;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS rating_counts integer[] NOT NULL DEFAULT '{0,0,0,0,0}';
+
+-- refresh_book_rating works the rating statistics of a book out again
+-- from its reviews. A book without reviews goes back to 0
+CREATE OR REPLACE FUNCTION refresh_book_rating(book bigint)
+RETURNS void AS $$
+BEGIN
+    UPDATE books
+    SET average_rating = COALESCE(stats.average, 0),
+        review_count = stats.total,
+        rating_counts = stats.counts
+    FROM (
+        SELECT ROUND(CAST(AVG(rating) AS NUMERIC), 2) AS average,
+               COUNT(*)::integer AS total,
+               ARRAY[
+                   COUNT(*) FILTER (WHERE round(rating) = 1)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 2)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 3)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 4)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 5)::integer
+               ] AS counts
+        FROM bookreviews
+        WHERE book_id = book AND deleted_at IS NULL
+    ) stats
+    WHERE books.id = book;
+END;
+$$ LANGUAGE plpgsql;
+
+-- NEW is NULL when a review is deleted and OLD when one is added, and a
+-- review moved to another book (as a merge does) changes two books
+CREATE OR REPLACE FUNCTION automatic_average_rating()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM refresh_book_rating(NEW.book_id);
+    ELSIF TG_OP = 'DELETE' THEN
+        PERFORM refresh_book_rating(OLD.book_id);
+    ELSE
+        PERFORM refresh_book_rating(OLD.book_id);
+        IF NEW.book_id IS DISTINCT FROM OLD.book_id THEN
+            PERFORM refresh_book_rating(NEW.book_id);
+        END IF;
+    END IF;
+
+    RETURN COALESCE(NEW, OLD);
+END;
+$$ LANGUAGE plpgsql;
+
+-- bring every book up to date, including those whose last review was
+-- deleted while the old trigger was in place
+SELECT refresh_book_rating(id) FROM books;
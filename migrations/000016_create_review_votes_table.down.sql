@@ -0,0 +1,14 @@
+DROP TRIGGER IF EXISTS update_book_rating ON bookreviews;
+CREATE TRIGGER update_book_rating
+AFTER INSERT OR UPDATE OR DELETE ON bookreviews
+FOR EACH ROW
+EXECUTE FUNCTION automatic_average_rating();
+
+DROP TABLE IF EXISTS review_votes;
+DROP FUNCTION IF EXISTS refresh_review_votes();
+DROP FUNCTION IF EXISTS wilson_lower_bound(integer, integer);
+
+DROP INDEX IF EXISTS bookreviews_helpful_idx;
+ALTER TABLE bookreviews DROP COLUMN IF EXISTS helpful_score;
+ALTER TABLE bookreviews DROP COLUMN IF EXISTS unhelpful_votes;
+ALTER TABLE bookreviews DROP COLUMN IF EXISTS helpful_votes;
@@ -0,0 +1,66 @@
+-- Members vote reviews up (1) or down (-1), once per review
+CREATE TABLE IF NOT EXISTS review_votes (
+    review_id bigint NOT NULL REFERENCES bookreviews(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    vote smallint NOT NULL CHECK (vote IN (-1, 1)),
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (review_id, user_id)
+);
+
+ALTER TABLE bookreviews ADD COLUMN IF NOT EXISTS helpful_votes integer NOT NULL DEFAULT 0;
+ALTER TABLE bookreviews ADD COLUMN IF NOT EXISTS unhelpful_votes integer NOT NULL DEFAULT 0;
+ALTER TABLE bookreviews ADD COLUMN IF NOT EXISTS helpful_score double precision NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS bookreviews_helpful_idx ON bookreviews (book_id, helpful_score DESC, id) WHERE deleted_at IS NULL;
+
+-- The lower bound of the 95% Wilson score interval of the share of up
+-- votes. A review with 40 of 50 up votes ranks above one with 2 of 2,
+-- which raw counts or plain ratios get wrong
+CREATE OR REPLACE FUNCTION wilson_lower_bound(up integer, down integer)
+RETURNS double precision AS $$
+    SELECT CASE WHEN up + down = 0 THEN 0 ELSE
+        (up::float8 / (up + down) + 1.9208 / (up + down)
+         - 1.96 * sqrt((up::float8 / (up + down) * (1 - up::float8 / (up + down)) + 0.9604 / (up + down)) / (up + down)))
+        / (1 + 3.8416 / (up + down))
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
+-- keep the tallies and score of a review up to date as votes come and go
+CREATE OR REPLACE FUNCTION refresh_review_votes()
+RETURNS TRIGGER AS $$
+DECLARE
+    review bigint;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        review := OLD.review_id;
+    ELSE
+        review := NEW.review_id;
+    END IF;
+
+    UPDATE bookreviews
+    SET helpful_votes = tally.up,
+        unhelpful_votes = tally.down,
+        helpful_score = wilson_lower_bound(tally.up, tally.down)
+    FROM (
+        SELECT COUNT(*) FILTER (WHERE vote = 1)::integer AS up,
+               COUNT(*) FILTER (WHERE vote = -1)::integer AS down
+        FROM review_votes
+        WHERE review_id = review
+    ) tally
+    WHERE bookreviews.id = review;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER update_review_votes
+AFTER INSERT OR UPDATE OR DELETE ON review_votes
+FOR EACH ROW
+EXECUTE FUNCTION refresh_review_votes();
+
+-- a vote changing the tallies of a review leaves the book's rating alone
+DROP TRIGGER IF EXISTS update_book_rating ON bookreviews;
+CREATE TRIGGER update_book_rating
+AFTER INSERT OR DELETE OR UPDATE OF book_id, rating, deleted_at ON bookreviews
+FOR EACH ROW
+EXECUTE FUNCTION automatic_average_rating();
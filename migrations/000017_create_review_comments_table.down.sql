@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS review_comments;
+DROP FUNCTION IF EXISTS refresh_review_comment_count();
+ALTER TABLE bookreviews DROP COLUMN IF EXISTS comment_count;
@@ -0,0 +1,48 @@
+-- Comments on reviews. A comment with a parent_id is a reply to that
+-- comment, so a review's comments form a tree
+CREATE TABLE IF NOT EXISTS review_comments (
+    id bigserial PRIMARY KEY,
+    review_id bigint NOT NULL REFERENCES bookreviews(id) ON DELETE CASCADE,
+    parent_id bigint REFERENCES review_comments(id) ON DELETE CASCADE,
+    user_id bigint REFERENCES users(id) ON DELETE SET NULL,
+    body text NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    deleted_at timestamp(0) WITH TIME ZONE,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS review_comments_review_idx ON review_comments (review_id, created_at, id) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS review_comments_parent_idx ON review_comments (parent_id);
+
+ALTER TABLE bookreviews ADD COLUMN IF NOT EXISTS comment_count integer NOT NULL DEFAULT 0;
+
+-- deleted comments stay in the tree so their replies keep their place,
+-- but they no longer count
+CREATE OR REPLACE FUNCTION refresh_review_comment_count()
+RETURNS TRIGGER AS $$
+DECLARE
+    review bigint;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        review := OLD.review_id;
+    ELSE
+        review := NEW.review_id;
+    END IF;
+
+    UPDATE bookreviews
+    SET comment_count = (
+        SELECT COUNT(*)
+        FROM review_comments
+        WHERE review_id = review AND deleted_at IS NULL
+    )
+    WHERE id = review;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER update_review_comment_count
+AFTER INSERT OR DELETE OR UPDATE OF deleted_at ON review_comments
+FOR EACH ROW
+EXECUTE FUNCTION refresh_review_comment_count();
@@ -0,0 +1,34 @@
+DROP TRIGGER IF EXISTS update_book_rating ON bookreviews;
+CREATE TRIGGER update_book_rating
+AFTER INSERT OR DELETE OR UPDATE OF book_id, rating, deleted_at ON bookreviews
+FOR EACH ROW
+EXECUTE FUNCTION automatic_average_rating();
+
+CREATE OR REPLACE FUNCTION refresh_book_rating(book bigint)
+RETURNS void AS $$
+BEGIN
+    UPDATE books
+    SET average_rating = COALESCE(stats.average, 0),
+        review_count = stats.total,
+        rating_counts = stats.counts
+    FROM (
+        SELECT ROUND(CAST(AVG(rating) AS NUMERIC), 2) AS average,
+               COUNT(*)::integer AS total,
+               ARRAY[
+                   COUNT(*) FILTER (WHERE round(rating) = 1)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 2)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 3)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 4)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 5)::integer
+               ] AS counts
+        FROM bookreviews
+        WHERE book_id = book AND deleted_at IS NULL
+    ) stats
+    WHERE books.id = book;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS review_flags;
+ALTER TABLE bookreviews DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE bookreviews DROP COLUMN IF EXISTS hidden_at;
+DELETE FROM permissions WHERE code = 'reviews:moderate';
@@ -0,0 +1,59 @@
+INSERT INTO permissions (code)
+VALUES ('reviews:moderate')
+ON CONFLICT (code) DO NOTHING;
+
+-- A hidden review stays with its author but nobody else sees it and it
+-- doesn't count towards the book's rating
+ALTER TABLE bookreviews ADD COLUMN IF NOT EXISTS hidden_at timestamp(0) WITH TIME ZONE;
+
+-- the moderator who deleted a review. Its author can't restore it, only
+-- a moderator can
+ALTER TABLE bookreviews ADD COLUMN IF NOT EXISTS deleted_by bigint REFERENCES users(id) ON DELETE SET NULL;
+
+-- Members report reviews they think break the rules. A flag stays open
+-- until a moderator acts on the review
+CREATE TABLE IF NOT EXISTS review_flags (
+    id bigserial PRIMARY KEY,
+    review_id bigint NOT NULL REFERENCES bookreviews(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason text NOT NULL CHECK (reason IN ('spam', 'abuse', 'spoiler', 'off_topic', 'other')),
+    note text NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    resolved_at timestamp(0) WITH TIME ZONE,
+    resolved_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    resolution text CHECK (resolution IN ('hide', 'restore', 'delete'))
+);
+
+-- one open flag per member per review
+CREATE UNIQUE INDEX IF NOT EXISTS review_flags_open_key ON review_flags (review_id, user_id) WHERE resolved_at IS NULL;
+
+-- hidden reviews no longer count
+CREATE OR REPLACE FUNCTION refresh_book_rating(book bigint)
+RETURNS void AS $$
+BEGIN
+    UPDATE books
+    SET average_rating = COALESCE(stats.average, 0),
+        review_count = stats.total,
+        rating_counts = stats.counts
+    FROM (
+        SELECT ROUND(CAST(AVG(rating) AS NUMERIC), 2) AS average,
+               COUNT(*)::integer AS total,
+               ARRAY[
+                   COUNT(*) FILTER (WHERE round(rating) = 1)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 2)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 3)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 4)::integer,
+                   COUNT(*) FILTER (WHERE round(rating) = 5)::integer
+               ] AS counts
+        FROM bookreviews
+        WHERE book_id = book AND deleted_at IS NULL AND hidden_at IS NULL
+    ) stats
+    WHERE books.id = book;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS update_book_rating ON bookreviews;
+CREATE TRIGGER update_book_rating
+AFTER INSERT OR DELETE OR UPDATE OF book_id, rating, deleted_at, hidden_at ON bookreviews
+FOR EACH ROW
+EXECUTE FUNCTION automatic_average_rating();
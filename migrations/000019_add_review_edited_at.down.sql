@@ -0,0 +1 @@
+ALTER TABLE bookreviews DROP COLUMN IF EXISTS edited_at;
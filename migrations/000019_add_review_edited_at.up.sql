@@ -0,0 +1,3 @@
+-- when the rating or text of a review last changed, NULL if it never has.
+-- The earlier ratings and texts are in the revisions table
+ALTER TABLE bookreviews ADD COLUMN IF NOT EXISTS edited_at timestamp(0) WITH TIME ZONE;